@@ -0,0 +1,172 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// handlerName is the name of the SDK request handler recording calls.
+const handlerName = "cfn.audit.Recorder"
+
+// recorderKey is used to store a Recorder in a context.
+type recorderKey struct{}
+
+// A Call is an AWS API call made by a handler.
+type Call struct {
+	Service    string        `json:"service"`
+	Operation  string        `json:"operation"`
+	Latency    time.Duration `json:"latency"`
+	Retries    int           `json:"retries"`
+	StatusCode int           `json:"statusCode,omitempty"`
+	RequestID  string        `json:"requestId,omitempty"`
+	ErrorCode  string        `json:"errorCode,omitempty"`
+	// AssumedRole is set on the calls made with the credentials of an assumed
+	// role, such as the sessions of Request.AssumeRoleSession, which the
+	// caller's role doesn't authorize.
+	AssumedRole bool `json:"assumedRole,omitempty"`
+}
+
+// Name returns the name of the call, such as S3.GetObject.
+func (c Call) Name() string {
+	return c.Service + "." + c.Operation
+}
+
+// A Recorder records the AWS API calls made during an invocation.
+//
+// A nil Recorder records nothing.
+type Recorder struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+// NewRecorder creates an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Install records the calls made with an AWS SDK for Go v1 session, and with
+// the sessions copied from it, such as the ones of assumed roles.
+func (r *Recorder) Install(sess *session.Session) {
+	if r == nil || sess == nil {
+		return
+	}
+
+	// copies made for assumed roles replace the credentials
+	creds := sess.Config.Credentials
+	sess.Handlers.Complete.PushBackNamed(request.NamedHandler{
+		Name: handlerName,
+		Fn: func(req *request.Request) {
+			c := Call{
+				Service:     req.ClientInfo.ServiceID,
+				Latency:     time.Since(req.Time),
+				Retries:     req.RetryCount,
+				RequestID:   req.RequestID,
+				AssumedRole: req.Config.Credentials != creds,
+			}
+			if req.Operation != nil {
+				c.Operation = req.Operation.Name
+			}
+			if req.HTTPResponse != nil {
+				c.StatusCode = req.HTTPResponse.StatusCode
+			}
+			var aerr awserr.Error
+			if errors.As(req.Error, &aerr) {
+				c.ErrorCode = aerr.Code()
+			}
+			r.Record(c)
+		},
+	})
+}
+
+// Record records a call and writes it to the log at debug level.
+func (r *Recorder) Record(c Call) {
+	if r == nil {
+		return
+	}
+
+	slog.Debug("AWS API call",
+		"service", c.Service,
+		"operation", c.Operation,
+		"latencyMs", c.Latency.Milliseconds(),
+		"retries", c.Retries,
+		"statusCode", c.StatusCode,
+		"requestId", c.RequestID,
+		"errorCode", c.ErrorCode,
+	)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, c)
+}
+
+// Calls returns the calls recorded so far, in the order they completed.
+func (r *Recorder) Calls() []Call {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Call(nil), r.calls...)
+}
+
+// An OperationSummary totals the calls to an API operation.
+type OperationSummary struct {
+	Service   string `json:"service"`
+	Operation string `json:"operation"`
+	Calls     int    `json:"calls"`
+	Errors    int    `json:"errors"`
+	Retries   int    `json:"retries"`
+	LatencyMs int64  `json:"latencyMs"`
+}
+
+// Summary returns the totals of the calls recorded so far, per operation and
+// sorted by name.
+func (r *Recorder) Summary() []OperationSummary {
+	byName := map[string]*OperationSummary{}
+	var names []string
+	for _, c := range r.Calls() {
+		s, ok := byName[c.Name()]
+		if !ok {
+			s = &OperationSummary{Service: c.Service, Operation: c.Operation}
+			byName[c.Name()] = s
+			names = append(names, c.Name())
+		}
+
+		s.Calls++
+		s.Retries += c.Retries
+		s.LatencyMs += c.Latency.Milliseconds()
+		if len(c.ErrorCode) != 0 {
+			s.Errors++
+		}
+	}
+	sort.Strings(names)
+
+	summary := make([]OperationSummary, 0, len(names))
+	for _, name := range names {
+		summary = append(summary, *byName[name])
+	}
+
+	return summary
+}
+
+// NewContext returns a copy of ctx carrying the Recorder.
+func NewContext(ctx context.Context, r *Recorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, r)
+}
+
+// FromContext returns the Recorder carried by ctx, or nil.
+func FromContext(ctx context.Context) *Recorder {
+	r, _ := ctx.Value(recorderKey{}).(*Recorder)
+	return r
+}
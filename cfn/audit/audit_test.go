@@ -0,0 +1,165 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	awsv2 "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// throttlingClient answers every request with a throttling error.
+type throttlingClient struct {
+	contentType string
+	body        string
+}
+
+func (c throttlingClient) Do(r *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusBadRequest,
+		Header: http.Header{
+			"Content-Type":     []string{c.contentType},
+			"X-Amzn-Requestid": []string{"req-1"},
+		},
+		Body:    io.NopCloser(strings.NewReader(c.body)),
+		Request: r,
+	}, nil
+}
+
+func (c throttlingClient) RoundTrip(r *http.Request) (*http.Response, error) {
+	return c.Do(r)
+}
+
+func TestRecorder_Install(t *testing.T) {
+	// a CA bundle needs an *http.Transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+		HTTPClient: &http.Client{Transport: throttlingClient{
+			contentType: "text/xml",
+			body:        `<ErrorResponse><Error><Code>Throttling</Code><Message>Rate exceeded</Message></Error><RequestId>req-1</RequestId></ErrorResponse>`,
+		}},
+	}))
+
+	r := NewRecorder()
+	r.Install(sess)
+
+	// sessions copied from the caller's, such as assumed roles, are recorded too
+	svc := cloudformation.New(sess.Copy())
+	if _, err := svc.ListStacks(&cloudformation.ListStacksInput{}); err == nil {
+		t.Fatalf("Expected the call to fail")
+	}
+
+	// as are the calls made with an assumed role, flagged as such
+	assumed := cloudformation.New(sess.Copy(&aws.Config{Credentials: credentials.NewStaticCredentials("role", "secret", "token")}))
+	if _, err := assumed.ListStacks(&cloudformation.ListStacksInput{}); err == nil {
+		t.Fatalf("Expected the call to fail")
+	}
+
+	calls := r.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("Expected 2 calls, got %d", len(calls))
+	}
+	c := calls[0]
+	if c.Name() != "CloudFormation.ListStacks" || c.StatusCode != http.StatusBadRequest || c.RequestID != "req-1" || c.ErrorCode != "Throttling" || c.AssumedRole {
+		t.Errorf("Unexpected call: %+v", c)
+	}
+	if !calls[1].AssumedRole {
+		t.Errorf("Call with an assumed role not flagged: %+v", calls[1])
+	}
+}
+
+func TestAppendMiddlewares(t *testing.T) {
+	cfg := awsv2.Config{
+		Region: "us-east-1",
+		HTTPClient: throttlingClient{
+			contentType: "application/x-amz-json-1.1",
+			body:        `{"__type":"ThrottlingException","message":"Rate exceeded"}`,
+		},
+		Retryer: func() awsv2.Retryer { return awsv2.NopRetryer{} },
+		Credentials: awsv2.CredentialsProviderFunc(func(context.Context) (awsv2.Credentials, error) {
+			return awsv2.Credentials{AccessKeyID: "id", SecretAccessKey: "secret"}, nil
+		}),
+	}
+	AppendMiddlewares(&cfg.APIOptions)
+	client := eventbridge.NewFromConfig(cfg)
+
+	// calls without a recorder in their context aren't recorded
+	if _, err := client.ListRules(context.Background(), &eventbridge.ListRulesInput{}); err == nil {
+		t.Fatalf("Expected the call to fail")
+	}
+
+	r := NewRecorder()
+	if _, err := client.ListRules(NewContext(context.Background(), r), &eventbridge.ListRulesInput{}); err == nil {
+		t.Fatalf("Expected the call to fail")
+	}
+
+	calls := r.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("Expected 1 call, got %d", len(calls))
+	}
+	c := calls[0]
+	if c.Name() != "EventBridge.ListRules" || c.StatusCode != http.StatusBadRequest || c.RequestID != "req-1" || c.ErrorCode != "ThrottlingException" {
+		t.Errorf("Unexpected call: %+v", c)
+	}
+}
+
+func TestRecorder_Summary(t *testing.T) {
+	r := NewRecorder()
+	r.Record(Call{Service: "S3", Operation: "GetObject", Latency: 20 * time.Millisecond})
+	r.Record(Call{Service: "S3", Operation: "GetObject", Latency: 30 * time.Millisecond, Retries: 2, ErrorCode: "SlowDown"})
+	r.Record(Call{Service: "EC2", Operation: "DescribeVpcs", Latency: 10 * time.Millisecond})
+
+	want := []OperationSummary{
+		{Service: "EC2", Operation: "DescribeVpcs", Calls: 1, LatencyMs: 10},
+		{Service: "S3", Operation: "GetObject", Calls: 2, Errors: 1, Retries: 2, LatencyMs: 50},
+	}
+	got := r.Summary()
+	if len(got) != len(want) {
+		t.Fatalf("Summary() = %+v; want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Summary()[%d] = %+v; want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRecorder_Record(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	r := NewRecorder()
+	r.Record(Call{Service: "S3", Operation: "GetObject"})
+
+	if !strings.Contains(buf.String(), `"level":"DEBUG","msg":"AWS API call"`) {
+		t.Errorf("Calls should be logged at debug level: %s", buf.String())
+	}
+}
+
+func TestRecorder_Nil(t *testing.T) {
+	t.Setenv("AWS_CA_BUNDLE", "")
+	var r *Recorder
+	r.Record(Call{Service: "S3", Operation: "GetObject"})
+	r.Install(session.Must(session.NewSession()))
+
+	if len(r.Calls()) != 0 || len(r.Summary()) != 0 {
+		t.Errorf("A nil Recorder shouldn't record calls")
+	}
+	if FromContext(context.Background()) != nil {
+		t.Errorf("Expected no recorder in the context")
+	}
+}
@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// AppendMiddlewares adds a middleware to AWS SDK for Go v2 API options, such as
+// aws.Config.APIOptions, that records each call in the Recorder of the context
+// of the call.
+func AppendMiddlewares(apiOptions *[]func(*middleware.Stack) error) {
+	*apiOptions = append(*apiOptions, func(s *middleware.Stack) error {
+		return s.Initialize.Add(middleware.InitializeMiddlewareFunc("CfnAudit", handleInitialize), middleware.After)
+	})
+}
+
+func handleInitialize(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	r := FromContext(ctx)
+	if r == nil {
+		return next.HandleInitialize(ctx, in)
+	}
+
+	start := time.Now()
+	out, metadata, err := next.HandleInitialize(ctx, in)
+
+	c := Call{
+		Service:   awsmiddleware.GetServiceID(ctx),
+		Operation: awsmiddleware.GetOperationName(ctx),
+		Latency:   time.Since(start),
+	}
+	if attempts, ok := retry.GetAttemptResults(metadata); ok && len(attempts.Results) > 0 {
+		c.Retries = len(attempts.Results) - 1
+	}
+	if id, ok := awsmiddleware.GetRequestIDMetadata(metadata); ok {
+		c.RequestID = id
+	}
+	if resp, ok := awsmiddleware.GetRawResponse(metadata).(*smithyhttp.Response); ok {
+		c.StatusCode = resp.StatusCode
+	}
+
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) {
+		c.StatusCode = respErr.HTTPStatusCode()
+	}
+	var reqErr interface{ ServiceRequestID() string }
+	if errors.As(err, &reqErr) && len(c.RequestID) == 0 {
+		c.RequestID = reqErr.ServiceRequestID()
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		c.ErrorCode = apiErr.ErrorCode()
+	} else if err != nil {
+		c.ErrorCode = "ClientError"
+	}
+
+	r.Record(c)
+
+	return out, metadata, err
+}
@@ -0,0 +1,21 @@
+/*
+Package audit records the AWS API calls made by resource handlers.
+
+Each call is logged at debug level, so set CFN_LOG_LEVEL=DEBUG to see them;
+a summary of the calls of every invocation is logged at info level.
+
+The calls can be checked against the permissions the resource schema declares
+for each handler. CheckPermissions maps each call to the IAM action authorizing
+it, such as s3:PutBucketTagging, and reports the actions missing from the schema
+and the declared permissions no call used. Calls made with an assumed role are
+left out, as that role authorizes them. Set CFN_PERMISSION_CHECK=true, or pass
+cfn.WithPermissionCheck, to log the report of every invocation, or check the
+calls of a Recorder in handler tests:
+
+	declared, _ := audit.SchemaPermissions(schema)
+	r := audit.CheckPermissions(declared, "CREATE", recorder.Calls())
+	if !r.OK() {
+		t.Errorf("missing permissions: %v", r.Missing)
+	}
+*/
+package audit
@@ -0,0 +1,175 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PermissionCheckEnv is the environment variable turning on the permission
+// check of the runtime, see CheckPermissions.
+const PermissionCheckEnv = "CFN_PERMISSION_CHECK"
+
+// PermissionCheckEnabled reports whether PermissionCheckEnv turns on the
+// permission check. It's off unless set to a true value.
+func PermissionCheckEnabled() bool {
+	v, _ := strconv.ParseBool(os.Getenv(PermissionCheckEnv))
+	return v
+}
+
+// servicePrefixes maps the service IDs whose IAM service prefix isn't the
+// lower case service ID without spaces.
+var servicePrefixes = map[string]string{
+	"API Gateway":                   "apigateway",
+	"ApiGatewayV2":                  "apigateway",
+	"Application Auto Scaling":      "application-autoscaling",
+	"Application Discovery Service": "discovery",
+	"CloudWatch Events":             "events",
+	"CloudWatch Logs":               "logs",
+	"CodeStar connections":          "codestar-connections",
+	"Cognito Identity Provider":     "cognito-idp",
+	"Cognito Identity":              "cognito-identity",
+	"DocDB":                         "rds",
+	"DynamoDB Streams":              "dynamodb",
+	"EFS":                           "elasticfilesystem",
+	"Elastic Load Balancing v2":     "elasticloadbalancing",
+	"Elastic Load Balancing":        "elasticloadbalancing",
+	"Elastic Transcoder":            "elastictranscoder",
+	"Elasticsearch Service":         "es",
+	"EventBridge":                   "events",
+	"Firehose":                      "firehose",
+	"IoT Data Plane":                "iot",
+	"Kinesis Analytics V2":          "kinesisanalytics",
+	"Neptune":                       "rds",
+	"OpenSearch":                    "es",
+	"Resource Groups Tagging API":   "tag",
+	"Route53 Resolver":              "route53resolver",
+	"Service Quotas":                "servicequotas",
+	"SESv2":                         "ses",
+	"SFN":                           "states",
+}
+
+// operationActions maps the API operations authorized by an IAM action with
+// another name.
+var operationActions = map[string]string{
+	"S3.HeadBucket":      "s3:ListBucket",
+	"S3.HeadObject":      "s3:GetObject",
+	"S3.ListObjects":     "s3:ListBucket",
+	"S3.ListObjectsV2":   "s3:ListBucket",
+	"S3.DeleteObjects":   "s3:DeleteObject",
+	"Lambda.Invoke":      "lambda:InvokeFunction",
+	"Lambda.InvokeAsync": "lambda:InvokeFunction",
+}
+
+// Permission returns the IAM action authorizing a call, such as s3:PutBucketTagging.
+func Permission(c Call) string {
+	if a, ok := operationActions[c.Name()]; ok {
+		return a
+	}
+
+	prefix, ok := servicePrefixes[c.Service]
+	if !ok {
+		prefix = strings.ToLower(strings.ReplaceAll(c.Service, " ", ""))
+	}
+
+	return prefix + ":" + c.Operation
+}
+
+// A PermissionReport compares the IAM actions a handler used with the
+// permissions the resource schema declares for it.
+type PermissionReport struct {
+	Action   string   `json:"action"`
+	Used     []string `json:"used"`
+	Declared []string `json:"declared"`
+	// Missing lists the actions used but not declared; the handler fails
+	// with AccessDenied once deployed.
+	Missing []string `json:"missing"`
+	// Unused lists the declared permissions no call used. An invocation
+	// rarely exercises every code path, so they're only a hint.
+	Unused []string `json:"unused"`
+}
+
+// OK reports whether every action used was declared.
+func (r PermissionReport) OK() bool {
+	return len(r.Missing) == 0
+}
+
+// SchemaPermissions returns the permissions declared in the handlers section of
+// a resource schema, keyed by action, such as CREATE.
+func SchemaPermissions(schema []byte) (map[string][]string, error) {
+	var s struct {
+		Handlers map[string]struct {
+			Permissions []string `json:"permissions"`
+		} `json:"handlers"`
+	}
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return nil, fmt.Errorf("unable to read the resource schema: %w", err)
+	}
+
+	permissions := map[string][]string{}
+	for action, h := range s.Handlers {
+		permissions[strings.ToUpper(action)] = h.Permissions
+	}
+
+	return permissions, nil
+}
+
+// CheckPermissions compares the IAM actions implied by calls with the
+// permissions declared for action, such as CREATE.
+//
+// Declared permissions may use the IAM wildcards * and ?, and are matched
+// ignoring case as IAM does. Calls made with an assumed role are skipped, as
+// that role's policies authorize them.
+func CheckPermissions(declared map[string][]string, action string, calls []Call) PermissionReport {
+	r := PermissionReport{
+		Action:   action,
+		Declared: append([]string(nil), declared[strings.ToUpper(action)]...),
+	}
+	sort.Strings(r.Declared)
+
+	seen := map[string]bool{}
+	for _, c := range calls {
+		if c.AssumedRole {
+			continue
+		}
+		p := Permission(c)
+		if !seen[p] {
+			seen[p] = true
+			r.Used = append(r.Used, p)
+		}
+	}
+	sort.Strings(r.Used)
+
+	matched := map[string]bool{}
+	for _, p := range r.Used {
+		ok := false
+		for _, d := range r.Declared {
+			if matchPermission(d, p) {
+				matched[d] = true
+				ok = true
+			}
+		}
+		if !ok {
+			r.Missing = append(r.Missing, p)
+		}
+	}
+
+	for _, d := range r.Declared {
+		if !matched[d] {
+			r.Unused = append(r.Unused, d)
+		}
+	}
+
+	return r
+}
+
+// matchPermission reports whether the declared permission pattern authorizes action.
+func matchPermission(pattern string, action string) bool {
+	// IAM actions never contain a slash, so path.Match is a glob on the whole action
+	ok, err := path.Match(strings.ToLower(pattern), strings.ToLower(action))
+	return err == nil && ok
+}
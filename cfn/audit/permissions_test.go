@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPermission(t *testing.T) {
+	for _, tt := range []struct {
+		call Call
+		want string
+	}{
+		{Call{Service: "S3", Operation: "PutBucketTagging"}, "s3:PutBucketTagging"},
+		{Call{Service: "S3", Operation: "HeadObject"}, "s3:GetObject"},
+		{Call{Service: "CloudWatch Logs", Operation: "CreateLogGroup"}, "logs:CreateLogGroup"},
+		{Call{Service: "Secrets Manager", Operation: "GetSecretValue"}, "secretsmanager:GetSecretValue"},
+		{Call{Service: "Lambda", Operation: "Invoke"}, "lambda:InvokeFunction"},
+	} {
+		if got := Permission(tt.call); got != tt.want {
+			t.Errorf("Permission(%v) = %q; want %q", tt.call.Name(), got, tt.want)
+		}
+	}
+}
+
+func TestSchemaPermissions(t *testing.T) {
+	schema := []byte(`{
+		"typeName": "Foo::Bar::Baz",
+		"handlers": {
+			"create": {"permissions": ["s3:CreateBucket", "s3:PutBucketTagging"]},
+			"read": {"permissions": ["s3:Get*"]}
+		}
+	}`)
+
+	got, err := SchemaPermissions(schema)
+	if err != nil {
+		t.Fatalf("SchemaPermissions() = %v", err)
+	}
+
+	want := map[string][]string{
+		"CREATE": {"s3:CreateBucket", "s3:PutBucketTagging"},
+		"READ":   {"s3:Get*"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+
+	if _, err := SchemaPermissions([]byte(`{`)); err == nil {
+		t.Errorf("Expected an error for an invalid schema")
+	}
+}
+
+func TestCheckPermissions(t *testing.T) {
+	declared := map[string][]string{
+		"CREATE": {"s3:CreateBucket", "S3:get*", "s3:PutBucketTagging", "iam:PassRole"},
+	}
+	calls := []Call{
+		{Service: "S3", Operation: "CreateBucket"},
+		{Service: "S3", Operation: "CreateBucket"},
+		{Service: "S3", Operation: "GetBucketTagging"},
+		{Service: "S3", Operation: "HeadObject"},
+		{Service: "S3", Operation: "PutBucketPolicy"},
+		// authorized by the assumed role
+		{Service: "S3", Operation: "DeleteBucket", AssumedRole: true},
+	}
+
+	got := CheckPermissions(declared, "CREATE", calls)
+	want := PermissionReport{
+		Action:   "CREATE",
+		Used:     []string{"s3:CreateBucket", "s3:GetBucketTagging", "s3:GetObject", "s3:PutBucketPolicy"},
+		Declared: []string{"S3:get*", "iam:PassRole", "s3:CreateBucket", "s3:PutBucketTagging"},
+		Missing:  []string{"s3:PutBucketPolicy"},
+		Unused:   []string{"iam:PassRole", "s3:PutBucketTagging"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+	if got.OK() {
+		t.Errorf("OK() = true; want false")
+	}
+
+	if r := CheckPermissions(declared, "DELETE", nil); !r.OK() || len(r.Declared) != 0 {
+		t.Errorf("CheckPermissions(DELETE) = %+v; want an empty report", r)
+	}
+}
+
+func TestPermissionCheckEnabled(t *testing.T) {
+	for v, want := range map[string]bool{"": false, "true": true, "1": true, "false": false, "nope": false} {
+		t.Setenv(PermissionCheckEnv, v)
+		if got := PermissionCheckEnabled(); got != want {
+			t.Errorf("PermissionCheckEnabled() with %q = %v; want %v", v, got, want)
+		}
+	}
+}
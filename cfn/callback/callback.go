@@ -1,6 +1,3 @@
-//go:build callback
-// +build callback
-
 /*
 Package callback provides functions for creating resource providers
 that may need to be called multiple times while waiting
@@ -9,14 +6,21 @@ for resources to settle.
 package callback
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/avast/retry-go"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/cfnerr"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/logging"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
 	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
 )
 
@@ -25,17 +29,54 @@ const (
 	ServiceInternalError string = "ServiceInternal"
 	// MaxRetries is the number of retries allowed to report status.
 	MaxRetries uint = 3
+	// RetryBaseDelay is the delay before the first retry to report status,
+	// doubling with each retry.
+	RetryBaseDelay = 200 * time.Millisecond
+	// RetryMaxDelay caps the delay between retries to report status.
+	RetryMaxDelay = 2 * time.Second
+	// MinReportInterval is the minimum time between two progress reports, see ReportProgress.
+	MinReportInterval = 5 * time.Second
 )
 
+// ErrRateLimited is returned by ReportProgress when the report is dropped
+// because the previous one was made less than MinReportInterval ago.
+var ErrRateLimited = errors.New("progress reported too often")
+
+// EnabledEnv is the environment variable that turns progress reporting off when
+// set to false, in which case progress is only logged.
+const EnabledEnv = "CFN_CALLBACK"
+
+// CloudFormationAPI is the subset of the CloudFormation API used to report progress.
+//
+// It is satisfied by the AWS SDK for Go v2 client, *cloudformation.Client.
+type CloudFormationAPI interface {
+	RecordHandlerProgress(ctx context.Context, params *cloudformation.RecordHandlerProgressInput, optFns ...func(*cloudformation.Options)) (*cloudformation.RecordHandlerProgressOutput, error)
+}
+
 // CloudFormationCallbackAdapter used to report progress events back to CloudFormation.
 type CloudFormationCallbackAdapter struct {
-	client      cloudformationiface.CloudFormationAPI
+	client      CloudFormationAPI
 	bearerToken string
 	logger      *log.Logger
+	limiter     limiter
 }
 
-// New creates a CloudFormationCallbackAdapter and returns a pointer to the struct.
+// New creates a CloudFormationCallbackAdapter reporting with a client of the
+// AWS SDK for Go v1 and returns a pointer to the struct.
+//
+// Deprecated: use NewV2 with a client of the AWS SDK for Go v2.
 func New(client cloudformationiface.CloudFormationAPI, bearerToken string) *CloudFormationCallbackAdapter {
+	return NewV2(cloudFormationV1{client: client}, bearerToken)
+}
+
+// NewV2 creates a CloudFormationCallbackAdapter and returns a pointer to the struct.
+//
+// If reporting is turned off through CFN_CALLBACK, the adapter only logs the progress.
+func NewV2(client CloudFormationAPI, bearerToken string) *CloudFormationCallbackAdapter {
+	if v, err := strconv.ParseBool(os.Getenv(EnabledEnv)); err == nil && !v {
+		return NewNoop(bearerToken)
+	}
+
 	return &CloudFormationCallbackAdapter{
 		client:      client,
 		bearerToken: bearerToken,
@@ -43,6 +84,16 @@ func New(client cloudformationiface.CloudFormationAPI, bearerToken string) *Clou
 	}
 }
 
+// NewNoop creates a CloudFormationCallbackAdapter that logs the progress
+// instead of reporting it, for example when testing locally.
+func NewNoop(bearerToken string) *CloudFormationCallbackAdapter {
+	return &CloudFormationCallbackAdapter{
+		client:      newNoopClient(),
+		bearerToken: bearerToken,
+		logger:      logging.New("callback"),
+	}
+}
+
 // ReportStatus reports the status back to the Cloudformation service of a handler
 // that has moved from Pending to In_Progress
 func (c *CloudFormationCallbackAdapter) ReportStatus(operationStatus Status, model []byte, message string, errCode string) error {
@@ -52,6 +103,19 @@ func (c *CloudFormationCallbackAdapter) ReportStatus(operationStatus Status, mod
 	return nil
 }
 
+// ReportProgress reports that the operation is still in progress, with a status
+// message and the current model, for example during a long stabilization.
+//
+// Reports are rate limited so handlers can't flood the API: a report made less
+// than MinReportInterval after the previous one is dropped and ErrRateLimited returned.
+func (c *CloudFormationCallbackAdapter) ReportProgress(message string, model []byte) error {
+	if !c.limiter.allow() {
+		return ErrRateLimited
+	}
+
+	return c.reportProgress("", InProgress, InProgress, model, message)
+}
+
 // ReportInitialStatus reports the initial status back to the Cloudformation service.
 func (c *CloudFormationCallbackAdapter) ReportInitialStatus() error {
 	if err := c.reportProgress("", InProgress, Pending, []byte(""), ""); err != nil {
@@ -73,29 +137,29 @@ func (c *CloudFormationCallbackAdapter) reportProgress(errCode string, operation
 
 	in := cloudformation.RecordHandlerProgressInput{
 		BearerToken:     aws.String(c.bearerToken),
-		OperationStatus: aws.String(TranslateOperationStatus(operationStatus)),
+		OperationStatus: types.OperationStatus(TranslateOperationStatus(operationStatus)),
 	}
 
 	if len(statusMessage) != 0 {
-		in.SetStatusMessage(statusMessage)
+		in.StatusMessage = aws.String(statusMessage)
 	}
 
 	if len(resourceModel) != 0 {
-		in.SetResourceModel(string(resourceModel))
+		in.ResourceModel = aws.String(string(resourceModel))
 	}
 
 	if len(errCode) != 0 {
-		in.SetErrorCode(TranslateErrorCode(errCode))
+		in.ErrorCode = types.HandlerErrorCode(TranslateErrorCode(errCode))
 	}
 
 	if len(currentOperationStatus) != 0 {
-		in.SetCurrentOperationStatus(TranslateOperationStatus(currentOperationStatus))
+		in.CurrentOperationStatus = types.OperationStatus(TranslateOperationStatus(currentOperationStatus))
 	}
 
 	// Do retries and emit logs.
 	rerr := retry.Do(
 		func() error {
-			_, err := c.client.RecordHandlerProgress(&in)
+			_, err := c.client.RecordHandlerProgress(context.Background(), &in)
 			if err != nil {
 				return err
 			}
@@ -105,6 +169,7 @@ func (c *CloudFormationCallbackAdapter) reportProgress(errCode string, operation
 			c.logger.Println(s)
 
 		}), retry.Attempts(MaxRetries),
+		retry.DelayType(backoff),
 	)
 
 	if rerr != nil {
@@ -114,30 +179,28 @@ func (c *CloudFormationCallbackAdapter) reportProgress(errCode string, operation
 	return nil
 }
 
+// backoff is the delay before retry n: an exponential backoff from RetryBaseDelay,
+// capped at RetryMaxDelay, of which a random half is jitter so handlers retrying
+// at the same time spread out.
+func backoff(n uint, _ *retry.Config) time.Duration {
+	d := RetryMaxDelay
+	if n < 16 && RetryBaseDelay<<n < d {
+		d = RetryBaseDelay << n
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
 // TranslateErrorCode : Translate the error code into a standard Cloudformation error
+//
+// Codes missing from the registry, see ErrorCodes, become InternalFailure.
 func TranslateErrorCode(errorCode string) string {
-
-	// Ensure the error code conforms to one of the available
-	switch errorCode {
-	case cloudformation.HandlerErrorCodeNotUpdatable,
-		cloudformation.HandlerErrorCodeInvalidRequest,
-		cloudformation.HandlerErrorCodeAccessDenied,
-		cloudformation.HandlerErrorCodeInvalidCredentials,
-		cloudformation.HandlerErrorCodeAlreadyExists,
-		cloudformation.HandlerErrorCodeNotFound,
-		cloudformation.HandlerErrorCodeResourceConflict,
-		cloudformation.HandlerErrorCodeThrottling,
-		cloudformation.HandlerErrorCodeServiceLimitExceeded,
-		cloudformation.HandlerErrorCodeNotStabilized,
-		cloudformation.HandlerErrorCodeGeneralServiceException,
-		cloudformation.HandlerErrorCodeServiceInternalError,
-		cloudformation.HandlerErrorCodeNetworkFailure,
-		cloudformation.HandlerErrorCodeInternalFailure:
+	if errorCodes.valid(errorCode) {
 		return errorCode
-	default:
-		// InternalFailure is CloudFormation's fallback error code when no more specificity is there
-		return cloudformation.HandlerErrorCodeInternalFailure
 	}
+
+	// InternalFailure is CloudFormation's fallback error code when no more specificity is there
+	return string(types.HandlerErrorCodeInternalFailure)
 }
 
 // TranslateOperationStatus Translate the operation Status into a standard Cloudformation error
@@ -145,16 +208,16 @@ func TranslateOperationStatus(operationStatus Status) string {
 
 	switch operationStatus {
 	case Success:
-		return cloudformation.OperationStatusSuccess
+		return string(types.OperationStatusSuccess)
 	case Failed:
-		return cloudformation.OperationStatusFailed
+		return string(types.OperationStatusFailed)
 	case InProgress:
-		return cloudformation.OperationStatusInProgress
+		return string(types.OperationStatusInProgress)
 	case Pending:
-		return cloudformation.OperationStatusPending
+		return string(types.OperationStatusPending)
 	default:
 		// default will be to fail on unknown status
-		return cloudformation.OperationStatusFailed
+		return string(types.OperationStatusFailed)
 	}
 
 }
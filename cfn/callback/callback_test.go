@@ -1,11 +1,15 @@
 package callback
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/logging"
-	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	cloudformationv1 "github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
 )
 
@@ -13,8 +17,8 @@ var MockModel = []byte("{\"foo\": \"bar\"}")
 
 // MockedEvents mocks the call to AWS CloudWatch Events
 type MockedCallback struct {
-	cloudformationiface.CloudFormationAPI
 	errCount int
+	inputs   []*cloudformation.RecordHandlerProgressInput
 }
 
 func NewMockedCallback(errCount int) *MockedCallback {
@@ -23,8 +27,9 @@ func NewMockedCallback(errCount int) *MockedCallback {
 	}
 }
 
-func (m *MockedCallback) RecordHandlerProgress(in *cloudformation.RecordHandlerProgressInput) (*cloudformation.RecordHandlerProgressOutput, error) {
+func (m *MockedCallback) RecordHandlerProgress(ctx context.Context, in *cloudformation.RecordHandlerProgressInput, optFns ...func(*cloudformation.Options)) (*cloudformation.RecordHandlerProgressOutput, error) {
 
+	m.inputs = append(m.inputs, in)
 	if m.errCount > 0 {
 		m.errCount--
 		return nil, errors.New("error")
@@ -42,10 +47,10 @@ func TestTranslateOperationStatus(t *testing.T) {
 		args args
 		want string
 	}{
-		{"TestSUCCESS", args{"SUCCESS"}, cloudformation.OperationStatusSuccess},
-		{"TestFAILED", args{"FAILED"}, cloudformation.OperationStatusFailed},
-		{"TestIN_PROGRESS", args{"IN_PROGRESS"}, cloudformation.OperationStatusInProgress},
-		{"TestFoo", args{"Foo"}, cloudformation.OperationStatusFailed},
+		{"TestSUCCESS", args{"SUCCESS"}, string(types.OperationStatusSuccess)},
+		{"TestFAILED", args{"FAILED"}, string(types.OperationStatusFailed)},
+		{"TestIN_PROGRESS", args{"IN_PROGRESS"}, string(types.OperationStatusInProgress)},
+		{"TestFoo", args{"Foo"}, string(types.OperationStatusFailed)},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -65,20 +70,24 @@ func TestTranslateErrorCode(t *testing.T) {
 		args args
 		want string
 	}{
-		{"TestNotUpdatable", args{"NotUpdatable"}, cloudformation.HandlerErrorCodeNotUpdatable},
-		{"TestInvalidRequest", args{"InvalidRequest"}, cloudformation.HandlerErrorCodeInvalidRequest},
-		{"AccessDenied", args{"AccessDenied"}, cloudformation.HandlerErrorCodeAccessDenied},
-		{"TestInvalidCredentials", args{"InvalidCredentials"}, cloudformation.HandlerErrorCodeInvalidCredentials},
-		{"TestAlreadyExists", args{"AlreadyExists"}, cloudformation.HandlerErrorCodeAlreadyExists},
-		{"TestNotFound", args{"NotFound"}, cloudformation.HandlerErrorCodeNotFound},
-		{"TestResourceConflict", args{"ResourceConflict"}, cloudformation.HandlerErrorCodeResourceConflict},
-		{"TestThrottling", args{"Throttling"}, cloudformation.HandlerErrorCodeThrottling},
-		{"TestServiceLimitExceeded", args{"ServiceLimitExceeded"}, cloudformation.HandlerErrorCodeServiceLimitExceeded},
-		{"TestGeneralServiceException", args{"GeneralServiceException"}, cloudformation.HandlerErrorCodeGeneralServiceException},
-		{"TestServiceInternalError", args{"ServiceInternalError"}, cloudformation.HandlerErrorCodeServiceInternalError},
-		{"TestNetworkFailure", args{"NetworkFailure"}, cloudformation.HandlerErrorCodeNetworkFailure},
-		{"TestFoo", args{"foo"}, cloudformation.HandlerErrorCodeInternalFailure},
-		{"TestInternalFailure", args{"InternalFailure"}, cloudformation.HandlerErrorCodeInternalFailure},
+		{"TestNotUpdatable", args{"NotUpdatable"}, string(types.HandlerErrorCodeNotUpdatable)},
+		{"TestInvalidRequest", args{"InvalidRequest"}, string(types.HandlerErrorCodeInvalidRequest)},
+		{"AccessDenied", args{"AccessDenied"}, string(types.HandlerErrorCodeAccessDenied)},
+		{"TestInvalidCredentials", args{"InvalidCredentials"}, string(types.HandlerErrorCodeInvalidCredentials)},
+		{"TestAlreadyExists", args{"AlreadyExists"}, string(types.HandlerErrorCodeAlreadyExists)},
+		{"TestNotFound", args{"NotFound"}, string(types.HandlerErrorCodeNotFound)},
+		{"TestResourceConflict", args{"ResourceConflict"}, string(types.HandlerErrorCodeResourceConflict)},
+		{"TestThrottling", args{"Throttling"}, string(types.HandlerErrorCodeThrottling)},
+		{"TestServiceLimitExceeded", args{"ServiceLimitExceeded"}, string(types.HandlerErrorCodeServiceLimitExceeded)},
+		{"TestGeneralServiceException", args{"GeneralServiceException"}, string(types.HandlerErrorCodeGeneralServiceException)},
+		{"TestServiceInternalError", args{"ServiceInternalError"}, string(types.HandlerErrorCodeServiceInternalError)},
+		{"TestNetworkFailure", args{"NetworkFailure"}, string(types.HandlerErrorCodeNetworkFailure)},
+		{"TestFoo", args{"foo"}, string(types.HandlerErrorCodeInternalFailure)},
+		{"TestInternalFailure", args{"InternalFailure"}, string(types.HandlerErrorCodeInternalFailure)},
+		{"TestUnknown", args{"Unknown"}, string(types.HandlerErrorCodeUnknown)},
+		{"TestUnsupportedTarget", args{"UnsupportedTarget"}, string(types.HandlerErrorCodeUnsupportedTarget)},
+		{"TestNonCompliant", args{"NonCompliant"}, string(types.HandlerErrorCodeNonCompliant)},
+		{"TestHandlerInternalFailure", args{"HandlerInternalFailure"}, string(types.HandlerErrorCodeHandlerInternalFailure)},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -91,7 +100,7 @@ func TestTranslateErrorCode(t *testing.T) {
 
 func TestCloudFormationCallbackAdapterReportProgress(t *testing.T) {
 	type fields struct {
-		client cloudformationiface.CloudFormationAPI
+		client CloudFormationAPI
 	}
 	type args struct {
 		bearerToken     string
@@ -108,6 +117,8 @@ func TestCloudFormationCallbackAdapterReportProgress(t *testing.T) {
 		wantErr bool
 	}{
 		{"TestRetryReturnNoErr", fields{NewMockedCallback(0)}, args{"123456", "ACCESSDENIED", "FAILED", "IN_PROGRESS", MockModel, "retry"}, false},
+		{"TestRetrySucceeds", fields{NewMockedCallback(2)}, args{"123456", "", "IN_PROGRESS", "IN_PROGRESS", MockModel, "retry"}, false},
+		{"TestRetryExhausted", fields{NewMockedCallback(3)}, args{"123456", "", "IN_PROGRESS", "IN_PROGRESS", MockModel, "retry"}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -122,3 +133,96 @@ func TestCloudFormationCallbackAdapterReportProgress(t *testing.T) {
 		})
 	}
 }
+
+// MockedV1Callback records the RecordHandlerProgress calls of an AWS SDK for Go v1 client.
+type MockedV1Callback struct {
+	cloudformationiface.CloudFormationAPI
+	inputs []*cloudformationv1.RecordHandlerProgressInput
+}
+
+func (m *MockedV1Callback) RecordHandlerProgress(in *cloudformationv1.RecordHandlerProgressInput) (*cloudformationv1.RecordHandlerProgressOutput, error) {
+	m.inputs = append(m.inputs, in)
+	return nil, nil
+}
+
+func TestNew(t *testing.T) {
+	client := &MockedV1Callback{}
+	c := New(client, "123456")
+
+	if err := c.ReportFailureStatus(MockModel, "NotFound", errors.New("bucket not found")); err != nil {
+		t.Fatalf("Error returned: %v", err)
+	}
+
+	if len(client.inputs) != 1 {
+		t.Fatalf("RecordHandlerProgress calls = %d; want 1", len(client.inputs))
+	}
+	in := client.inputs[0]
+	if *in.BearerToken != "123456" || *in.StatusMessage != "bucket not found" || *in.ResourceModel != string(MockModel) ||
+		*in.OperationStatus != "FAILED" || *in.CurrentOperationStatus != "IN_PROGRESS" || *in.ErrorCode != "NotFound" {
+		t.Errorf("RecordHandlerProgress input = %+v", in)
+	}
+}
+
+func TestNewV2(t *testing.T) {
+	t.Run("Enabled", func(t *testing.T) {
+		client := NewMockedCallback(0)
+		if c := NewV2(client, "123456"); c.client != client {
+			t.Fatalf("Expected the supplied client")
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Setenv(EnabledEnv, "false")
+
+		c := NewV2(NewMockedCallback(0), "123456")
+		if _, ok := c.client.(*noopClient); !ok {
+			t.Fatalf("Expected the noop client, got %T", c.client)
+		}
+		if err := c.ReportInitialStatus(); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+	})
+}
+
+func TestReportProgress(t *testing.T) {
+	client := NewMockedCallback(0)
+	c := NewV2(client, "123456")
+
+	if err := c.ReportProgress("Waiting for the bucket", MockModel); err != nil {
+		t.Fatalf("ReportProgress() = %v", err)
+	}
+	if err := c.ReportProgress("Still waiting", MockModel); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("ReportProgress() = %v; want ErrRateLimited", err)
+	}
+
+	if len(client.inputs) != 1 {
+		t.Fatalf("RecordHandlerProgress calls = %d; want 1", len(client.inputs))
+	}
+	in := client.inputs[0]
+	if *in.BearerToken != "123456" || *in.StatusMessage != "Waiting for the bucket" || *in.ResourceModel != string(MockModel) ||
+		in.OperationStatus != types.OperationStatusInProgress || in.CurrentOperationStatus != types.OperationStatusInProgress {
+		t.Errorf("RecordHandlerProgress input = %+v", in)
+	}
+
+	// the next report goes through once the interval has passed
+	c.limiter.last = time.Now().Add(-MinReportInterval)
+	if err := c.ReportProgress("Done waiting", nil); err != nil {
+		t.Fatalf("ReportProgress() = %v", err)
+	}
+	if len(client.inputs) != 2 {
+		t.Errorf("RecordHandlerProgress calls = %d; want 2", len(client.inputs))
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for n, want := range []time.Duration{RetryBaseDelay, 2 * RetryBaseDelay, 4 * RetryBaseDelay, 8 * RetryBaseDelay, RetryMaxDelay} {
+		for i := 0; i < 20; i++ {
+			if d := backoff(uint(n), nil); d < want/2 || d > want {
+				t.Errorf("backoff(%d) = %v; want between %v and %v", n, d, want/2, want)
+			}
+		}
+	}
+	if d := backoff(64, nil); d > RetryMaxDelay {
+		t.Errorf("backoff(64) = %v; want at most %v", d, RetryMaxDelay)
+	}
+}
@@ -0,0 +1,78 @@
+package callback
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+)
+
+// errorCodes is the registry of the handler error codes CloudFormation accepts.
+//
+// It's seeded with the HandlerErrorCode enum of the AWS SDK, so updating the
+// SDK picks up the codes the service adds.
+var errorCodes = newErrorCodeRegistry(types.HandlerErrorCode("").Values())
+
+type errorCodeRegistry struct {
+	mu    sync.RWMutex
+	codes map[string]bool
+}
+
+func newErrorCodeRegistry(values []types.HandlerErrorCode) *errorCodeRegistry {
+	r := &errorCodeRegistry{codes: map[string]bool{}}
+	for _, v := range values {
+		r.codes[string(v)] = true
+	}
+
+	return r
+}
+
+func (r *errorCodeRegistry) register(code string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.codes[code] = true
+}
+
+func (r *errorCodeRegistry) valid(code string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.codes[code]
+}
+
+func (r *errorCodeRegistry) list() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	codes := make([]string, 0, len(r.codes))
+	for c := range r.codes {
+		codes = append(codes, c)
+	}
+	sort.Strings(codes)
+
+	return codes
+}
+
+// ErrorCodes returns the handler error codes CloudFormation accepts, sorted.
+func ErrorCodes() []string {
+	return errorCodes.list()
+}
+
+// RegisterErrorCode adds a handler error code the service accepts but the AWS SDK
+// doesn't know about yet.
+func RegisterErrorCode(code string) {
+	errorCodes.register(code)
+}
+
+// ValidateErrorCode returns an error when CloudFormation doesn't accept the handler
+// error code, in which case it's reported as InternalFailure; providers can check
+// their codes before returning them.
+func ValidateErrorCode(code string) error {
+	if !errorCodes.valid(code) {
+		return fmt.Errorf("unknown handler error code %q", code)
+	}
+
+	return nil
+}
@@ -0,0 +1,33 @@
+package callback
+
+import (
+	"context"
+	"log"
+
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/logging"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+)
+
+type noopClient struct {
+	logger *log.Logger
+}
+
+func newNoopClient() *noopClient {
+	return &noopClient{
+		logger: logging.New("callback"),
+	}
+}
+
+func (m *noopClient) RecordHandlerProgress(ctx context.Context, in *cloudformation.RecordHandlerProgressInput, optFns ...func(*cloudformation.Options)) (*cloudformation.RecordHandlerProgressOutput, error) {
+	// the model may hold write-only and sensitive properties
+	m.logger.Printf("Record progress: status=%s current=%s errorCode=%s message=%q model=%s",
+		in.OperationStatus,
+		in.CurrentOperationStatus,
+		in.ErrorCode,
+		aws.ToString(in.StatusMessage),
+		logging.FormatModel([]byte(aws.ToString(in.ResourceModel))),
+	)
+	// out implementation doesn't care about the response
+	return nil, nil
+}
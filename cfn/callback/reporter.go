@@ -0,0 +1,197 @@
+package callback
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/cfnerr"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/logging"
+)
+
+// FileEnv is the environment variable naming a file progress is appended to as
+// JSON lines instead of being reported to CloudFormation, for local runs.
+const FileEnv = "CFN_CALLBACK_FILE"
+
+// Reporter reports the progress of an operation.
+//
+// It's implemented by CloudFormationCallbackAdapter, which reports to
+// CloudFormation, MemoryReporter, which keeps the reports for tests, and
+// FileReporter, which writes them as JSON lines.
+type Reporter interface {
+	ReportInitialStatus() error
+	ReportStatus(operationStatus Status, model []byte, message string, errCode string) error
+	ReportFailureStatus(model []byte, errCode string, handlerError error) error
+	ReportProgress(message string, model []byte) error
+}
+
+// NewReporter creates the Reporter of an operation: a FileReporter when
+// CFN_CALLBACK_FILE is set, otherwise an adapter reporting with client, see NewV2.
+func NewReporter(client CloudFormationAPI, bearerToken string) Reporter {
+	if name := os.Getenv(FileEnv); len(name) != 0 {
+		return NewFileReporter(name, bearerToken)
+	}
+
+	return NewV2(client, bearerToken)
+}
+
+// A Report is the progress of an operation, as sent to RecordHandlerProgress.
+//
+// Statuses and error codes are translated as CloudFormation receives them, see
+// TranslateOperationStatus and TranslateErrorCode.
+type Report struct {
+	Time                   time.Time `json:"time"`
+	BearerToken            string    `json:"bearerToken"`
+	OperationStatus        string    `json:"operationStatus"`
+	CurrentOperationStatus string    `json:"currentOperationStatus,omitempty"`
+	ErrorCode              string    `json:"errorCode,omitempty"`
+	StatusMessage          string    `json:"statusMessage,omitempty"`
+	ResourceModel          string    `json:"resourceModel,omitempty"`
+}
+
+func newReport(bearerToken string, errCode string, operationStatus Status, currentOperationStatus Status, model []byte, message string) Report {
+	r := Report{
+		Time:            time.Now(),
+		BearerToken:     bearerToken,
+		OperationStatus: TranslateOperationStatus(operationStatus),
+		StatusMessage:   message,
+		ResourceModel:   string(model),
+	}
+	if len(errCode) != 0 {
+		r.ErrorCode = TranslateErrorCode(errCode)
+	}
+	if len(currentOperationStatus) != 0 {
+		r.CurrentOperationStatus = TranslateOperationStatus(currentOperationStatus)
+	}
+
+	return r
+}
+
+// limiter drops the progress reports made less than MinReportInterval apart.
+type limiter struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+func (l *limiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.last.IsZero() && time.Since(l.last) < MinReportInterval {
+		return false
+	}
+	l.last = time.Now()
+
+	return true
+}
+
+// recorder implements Reporter by handing each report to record.
+type recorder struct {
+	bearerToken string
+	limiter     limiter
+	record      func(Report) error
+}
+
+// ReportInitialStatus records the initial status.
+func (r *recorder) ReportInitialStatus() error {
+	return r.record(newReport(r.bearerToken, "", InProgress, Pending, nil, ""))
+}
+
+// ReportStatus records the status of a handler that has moved from Pending to In_Progress.
+func (r *recorder) ReportStatus(operationStatus Status, model []byte, message string, errCode string) error {
+	return r.record(newReport(r.bearerToken, errCode, operationStatus, InProgress, model, message))
+}
+
+// ReportFailureStatus records the failure status.
+func (r *recorder) ReportFailureStatus(model []byte, errCode string, handlerError error) error {
+	return r.record(newReport(r.bearerToken, errCode, Failed, InProgress, model, handlerError.Error()))
+}
+
+// ReportProgress records that the operation is still in progress, rate limited
+// as CloudFormationCallbackAdapter.ReportProgress.
+func (r *recorder) ReportProgress(message string, model []byte) error {
+	if !r.limiter.allow() {
+		return ErrRateLimited
+	}
+
+	return r.record(newReport(r.bearerToken, "", InProgress, InProgress, model, message))
+}
+
+// MemoryReporter keeps the progress reports in memory, to assert on them in tests.
+type MemoryReporter struct {
+	recorder
+
+	mu      sync.Mutex
+	reports []Report
+}
+
+// NewMemoryReporter creates an empty MemoryReporter.
+func NewMemoryReporter(bearerToken string) *MemoryReporter {
+	m := &MemoryReporter{}
+	m.recorder = recorder{bearerToken: bearerToken, record: m.add}
+
+	return m
+}
+
+func (m *MemoryReporter) add(r Report) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.reports = append(m.reports, r)
+	return nil
+}
+
+// Reports returns the reports made so far, in order.
+func (m *MemoryReporter) Reports() []Report {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Report(nil), m.reports...)
+}
+
+// FileReporter appends the progress reports to a file, one JSON record per line.
+//
+// Resource models are redacted with logging.FormatModel.
+type FileReporter struct {
+	recorder
+
+	mu   sync.Mutex
+	name string
+}
+
+// NewFileReporter creates a FileReporter appending to the named file, which is
+// created on the first report.
+func NewFileReporter(name string, bearerToken string) *FileReporter {
+	f := &FileReporter{name: name}
+	f.recorder = recorder{bearerToken: bearerToken, record: f.write}
+
+	return f
+}
+
+func (f *FileReporter) write(r Report) error {
+	// the model may hold write-only and sensitive properties
+	r.ResourceModel = logging.FormatModel([]byte(r.ResourceModel))
+	line, err := json.Marshal(r)
+	if err != nil {
+		return cfnerr.New(ServiceInternalError, "Callback ReportProgress Error", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// the file is only open while writing, so warm containers don't leak it
+	file, err := os.OpenFile(f.name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return cfnerr.New(ServiceInternalError, "Callback ReportProgress Error", err)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return cfnerr.New(ServiceInternalError, "Callback ReportProgress Error", err)
+	}
+	if err := file.Close(); err != nil {
+		return cfnerr.New(ServiceInternalError, "Callback ReportProgress Error", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package callback
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/logging"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+var (
+	_ Reporter = (*CloudFormationCallbackAdapter)(nil)
+	_ Reporter = (*MemoryReporter)(nil)
+	_ Reporter = (*FileReporter)(nil)
+)
+
+// report makes the reports of an operation that fails after reporting progress.
+func report(t *testing.T, r Reporter) {
+	t.Helper()
+
+	if err := r.ReportInitialStatus(); err != nil {
+		t.Fatalf("ReportInitialStatus() = %v", err)
+	}
+	if err := r.ReportProgress("Waiting", MockModel); err != nil {
+		t.Fatalf("ReportProgress() = %v", err)
+	}
+	if err := r.ReportProgress("Still waiting", MockModel); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("ReportProgress() = %v; want ErrRateLimited", err)
+	}
+	if err := r.ReportFailureStatus(MockModel, "Unknown", errors.New("boom")); err != nil {
+		t.Fatalf("ReportFailureStatus() = %v", err)
+	}
+}
+
+var wantReports = []Report{
+	{BearerToken: "123456", OperationStatus: "IN_PROGRESS", CurrentOperationStatus: "PENDING"},
+	{BearerToken: "123456", OperationStatus: "IN_PROGRESS", CurrentOperationStatus: "IN_PROGRESS", StatusMessage: "Waiting", ResourceModel: string(MockModel)},
+	{BearerToken: "123456", OperationStatus: "FAILED", CurrentOperationStatus: "IN_PROGRESS", ErrorCode: "Unknown", StatusMessage: "boom", ResourceModel: string(MockModel)},
+}
+
+func TestMemoryReporter(t *testing.T) {
+	r := NewMemoryReporter("123456")
+	report(t, r)
+
+	if diff := cmp.Diff(wantReports, r.Reports(), cmpopts.IgnoreFields(Report{}, "Time")); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestFileReporter(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "progress.jsonl")
+	t.Setenv(FileEnv, name)
+	redactor, err := logging.NewSchemaRedactor([]byte(`{"writeOnlyProperties": ["/properties/foo"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logging.SetModelRedactor(redactor)
+	defer logging.SetModelRedactor(nil)
+
+	r := NewReporter(NewMockedCallback(0), "123456")
+	if _, ok := r.(*FileReporter); !ok {
+		t.Fatalf("NewReporter() = %T; want *FileReporter", r)
+	}
+	report(t, r)
+
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var got []Report
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var rep Report
+		if err := json.Unmarshal(s.Bytes(), &rep); err != nil {
+			t.Fatalf("Invalid line %s: %v", s.Text(), err)
+		}
+		got = append(got, rep)
+	}
+	// models written to the file are redacted
+	want := append([]Report(nil), wantReports...)
+	for i := range want {
+		if len(want[i].ResourceModel) != 0 {
+			want[i].ResourceModel = `{"foo":"` + logging.Redacted + `"}`
+		}
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(Report{}, "Time")); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestNewReporter(t *testing.T) {
+	if r := NewReporter(NewMockedCallback(0), "123456"); r == nil {
+		t.Fatalf("NewReporter() = nil")
+	} else if _, ok := r.(*CloudFormationCallbackAdapter); !ok {
+		t.Errorf("NewReporter() = %T; want *CloudFormationCallbackAdapter", r)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	for _, code := range []string{"Unknown", "UnsupportedTarget", "NonCompliant", "HandlerInternalFailure", "NotStabilized"} {
+		if err := ValidateErrorCode(code); err != nil {
+			t.Errorf("ValidateErrorCode(%q) = %v", code, err)
+		}
+	}
+	if err := ValidateErrorCode("Boom"); err == nil {
+		t.Errorf("Expected an error for an unknown code")
+	}
+
+	RegisterErrorCode("TestOnlyCode")
+	if got := TranslateErrorCode("TestOnlyCode"); got != "TestOnlyCode" {
+		t.Errorf("TranslateErrorCode() = %v; want the registered code", got)
+	}
+
+	codes := ErrorCodes()
+	for i := 1; i < len(codes); i++ {
+		if codes[i-1] >= codes[i] {
+			t.Fatalf("ErrorCodes() isn't sorted: %v", codes)
+		}
+	}
+}
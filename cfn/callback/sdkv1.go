@@ -0,0 +1,41 @@
+package callback
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go/aws"
+	cloudformationv1 "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+)
+
+// cloudFormationV1 adapts an AWS SDK for Go v1 client to CloudFormationAPI.
+//
+// It calls the same method as the adapter used to, so clients mocking only
+// that keep working.
+type cloudFormationV1 struct {
+	client cloudformationiface.CloudFormationAPI
+}
+
+// RecordHandlerProgress reports progress with the v1 client.
+func (c cloudFormationV1) RecordHandlerProgress(ctx context.Context, params *cloudformation.RecordHandlerProgressInput, optFns ...func(*cloudformation.Options)) (*cloudformation.RecordHandlerProgressOutput, error) {
+	in := &cloudformationv1.RecordHandlerProgressInput{
+		BearerToken:        params.BearerToken,
+		ClientRequestToken: params.ClientRequestToken,
+		ResourceModel:      params.ResourceModel,
+		StatusMessage:      params.StatusMessage,
+		OperationStatus:    aws.String(string(params.OperationStatus)),
+	}
+	if len(params.CurrentOperationStatus) != 0 {
+		in.CurrentOperationStatus = aws.String(string(params.CurrentOperationStatus))
+	}
+	if len(params.ErrorCode) != 0 {
+		in.ErrorCode = aws.String(string(params.ErrorCode))
+	}
+
+	if _, err := c.client.RecordHandlerProgress(in); err != nil {
+		return nil, err
+	}
+
+	return &cloudformation.RecordHandlerProgressOutput{}, nil
+}
@@ -3,20 +3,31 @@ package cfn
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
+	"log/slog"
 	"os"
-	"sync"
 	"time"
 
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/audit"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/callback"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/cfnerr"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/credentials"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/encoding"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/logging"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/metrics"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/profiling"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/scheduler"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/tracing"
 
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go/service/cloudwatch"
-	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	cloudformationv2 "github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -38,8 +49,6 @@ const (
 	listAction    = "LIST"
 )
 
-var once sync.Once
-
 // Handler is the interface that all resource providers must implement
 //
 // Each method of Handler maps directly to a CloudFormation action.
@@ -59,7 +68,9 @@ type Handler interface {
 // We define two lambda entry points; MakeEventFunc is the entry point to all
 // invocations of a custom resource and MakeTestEventFunc is the entry point that
 // allows the CLI's contract testing framework to invoke the resource's CRUDL handlers.
-func Start(h Handler) {
+//
+// Options configure optional runtime behaviour; see Option.
+func Start(h Handler, opts ...Option) {
 	defer func() {
 		if r := recover(); r != nil {
 			log.Printf("Handler panicked: %s", r)
@@ -68,7 +79,7 @@ func Start(h Handler) {
 	}()
 
 	log.Printf("Handler starting")
-	lambda.Start(makeEventFunc(h))
+	lambda.Start(makeEventFunc(h, opts...))
 
 	log.Printf("Handler finished")
 }
@@ -83,24 +94,119 @@ type eventFunc func(ctx context.Context, event *event) (response, error)
 type handlerFunc func(request handler.Request) handler.ProgressEvent
 
 // MakeEventFunc is the entry point to all invocations of a custom resource
-func makeEventFunc(h Handler) eventFunc {
-	return func(ctx context.Context, event *event) (response, error) {
-		ps := credentials.SessionFromCredentialsProvider(&event.RequestData.ProviderCredentials)
-		m := metrics.New(cloudwatch.New(ps), event.ResourceType)
-		once.Do(func() {
-			l, err := logging.NewCloudWatchLogsProvider(
-				cloudwatchlogs.New(ps),
-				event.RequestData.ProviderLogGroupName,
-			)
+func makeEventFunc(h Handler, opts ...Option) eventFunc {
+	o := newOptions(opts...)
+	// Set default logger to output to CWL in the provider account,
+	// logging to Stdout until the first event binds it.
+	tr := o.tracer()
+	pl := logging.NewProviderLogWriter(os.Stdout, o.logDestination.LogGroupOptions)
+	if o.providerLogs {
+		logging.SetProviderLogOutput(pl)
+	}
+	// Models logged or written outside the structured logger are redacted too
+	logging.SetModelRedactor(o.schema)
+	// Profiles logged as base64 chunks mustn't go through the redaction of the
+	// provider log output
+	prof := o.profiler.WithLogOutput(pl)
+	return func(ctx context.Context, event *event) (resp response, err error) {
+		start := time.Now()
+		defer func() {
+			// Send buffered provider logs before the response is returned
+			if err := pl.Flush(); err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to send provider logs: %v\n", err)
+			}
+		}()
+		rc := popRuntimeContext(event.CallbackContext, time.Now())
+		id := event.correlationID(rc.Attempt)
+		logging.SetCorrelationID(id)
+		summary := &invocationSummary{action: event.Action, attempt: rc.Attempt, start: start}
+		// Each invocation is a span in the trace of the operation
+		ctx, span := tr.Start(ctx, "CloudFormation "+event.Action, rc.TraceParent,
+			attribute.String("cfn.action", event.Action),
+			attribute.String("cfn.resource_type", event.ResourceType),
+			attribute.String("cfn.logical_resource_id", event.RequestData.LogicalResourceID),
+			attribute.Int("cfn.attempt", rc.Attempt),
+			attribute.String("cfn.correlation_id", id),
+		)
+		rc.TraceParent = tracing.Inject(ctx)
+		defer func() {
+			span.SetAttributes(attribute.String("cfn.operation_status", string(resp.OperationStatus)))
+			if resp.OperationStatus == handler.Failed {
+				span.SetStatus(codes.Error, resp.Message)
+			}
+			span.End()
+			fctx, cancel := context.WithTimeout(ctx, traceFlushTimeout)
+			defer cancel()
+			if err := tr.Flush(fctx); err != nil {
+				log.Printf("Unable to send traces: %v", err)
+			}
+		}()
+		defer func() {
+			// Let support find the logs of a failure from the console
+			if resp.OperationStatus == handler.Failed {
+				resp.Message = withReference(resp.Message, id)
+			}
+		}()
+		pc := o.config(&event.RequestData.ProviderCredentials, event.Region)
+		m := o.publisher(pc, event.ResourceType)
+		m.SetCorrelationID(id)
+		// The summary is logged once the metrics are sent, to record the outcome
+		var flushErr error
+		defer func() { summary.log(resp, flushErr) }()
+		defer func() {
+			// Metrics are sent once per invocation; failing to send them
+			// mustn't change the response
+			fctx, cancel := context.WithTimeout(ctx, o.metricsFlushTimeout)
+			defer cancel()
+			if flushErr = m.Flush(fctx); flushErr != nil {
+				log.Printf("Unable to send metrics: %v", flushErr)
+			}
+		}()
+		re := newReportErr(m)
+		defer re.publish()
+		// Provider credentials expire and the log group may change between
+		// invocations of a warm container, so the log output is re-bound every time.
+		if o.providerLogs {
+			streamName, err := o.logDestination.StreamName(logging.StreamNameFields{
+				StackName:          credentials.StackName(event.StackID),
+				LogicalResourceID:  event.RequestData.LogicalResourceID,
+				Action:             event.Action,
+				ClientRequestToken: event.requestToken(),
+			})
 			if err != nil {
+				log.Printf("Unable to name the provider log stream: %v", err)
+			}
+			if err := pl.Bind(
+				cloudwatchlogs.NewFromConfig(pc),
+				event.RequestData.ProviderLogGroupName,
+				streamName,
+				event.RequestData.ProviderCredentials.AccessKeyID,
+			); err != nil {
 				log.Printf("Error: %v, Logging to Stdout", err)
-				m.PublishExceptionMetric(time.Now(), event.Action, err)
-				l = os.Stdout
+				re.fail(event.Action, err)
 			}
-			// Set default logger to output to CWL in the provider account
-			logging.SetProviderLogOutput(l)
-		})
-		re := newReportErr(m)
+		}
+		// Every record, including the standard log output, carries the request fields
+		setLogger := func(attempt int, id string) {
+			slog.SetDefault(logging.NewLogger(
+				logging.ProviderLogOutput(),
+				o.level(event.RequestData.TypeConfiguration),
+				logging.RequestFields{
+					Action:             event.Action,
+					ResourceType:       event.ResourceType,
+					LogicalResourceID:  event.RequestData.LogicalResourceID,
+					StackID:            event.StackID,
+					ClientRequestToken: event.requestToken(),
+					CallbackAttempt:    attempt,
+					CorrelationID:      id,
+				},
+				o.schema,
+			))
+		}
+		setLogger(rc.Attempt, id)
+		// Handlers publish custom metrics in the same batch as the runtime's
+		metrics.SetDefault(m.Recorder(event.Action))
+		defer metrics.SetDefault(nil)
 
 		handlerFn, cfnErr := router(event.Action, h)
 		log.Printf("Handler received the %s action", event.Action)
@@ -110,6 +216,10 @@ func makeEventFunc(h Handler) eventFunc {
 		if err := validateEvent(event); err != nil {
 			return re.report(event, "validation error", err, invalidRequestError)
 		}
+		if isMutatingAction(event.Action) && event.RequestData.CallerCredentials.IsEmpty() {
+			err := cfnerr.New(cloudformation.HandlerErrorCodeInvalidCredentials, "No caller credentials were supplied", nil)
+			return re.reportFailure(event, err, cloudformation.HandlerErrorCodeInvalidCredentials), nil
+		}
 		rctx := handler.RequestContext{
 			StackID:    event.StackID,
 			Region:     event.Region,
@@ -118,17 +228,74 @@ func makeEventFunc(h Handler) eventFunc {
 			SystemTags: event.RequestData.SystemTags,
 			NextToken:  event.NextToken,
 		}
-		request := handler.NewRequest(
-			event.RequestData.LogicalResourceID,
-			event.CallbackContext,
-			rctx,
-			credentials.SessionFromCredentialsProvider(&event.RequestData.CallerCredentials),
-			event.RequestData.PreviousResourceProperties,
-			event.RequestData.ResourceProperties,
-			event.RequestData.TypeConfiguration,
-		)
-		p := invoke(handlerFn, request, m, event.Action)
+		// Every AWS API call of the handler is recorded, and traced when tracing is on
+		calls := audit.NewRecorder()
+		sess := o.session(&event.RequestData.CallerCredentials)
+		calls.Install(sess)
+		tracing.Install(sess)
+		ctx = audit.NewContext(ctx, calls)
+		// Handlers of long operations can update their status message
+		var progress callback.Reporter
+		if isMutatingAction(event.Action) {
+			progress = callback.NewReporter(cloudformationv2.NewFromConfig(pc), event.BearerToken)
+		}
+		newRequest := func(callbackContext map[string]interface{}, body []byte) handler.Request {
+			return handler.NewRequest(
+				event.RequestData.LogicalResourceID,
+				callbackContext,
+				rctx,
+				sess,
+				event.RequestData.PreviousResourceProperties,
+				body,
+				event.RequestData.TypeConfiguration,
+			).WithContext(ctx).WithProgressReporter(progress)
+		}
+		body := event.RequestData.ResourceProperties
+		request := newRequest(event.CallbackContext, body)
+		summary.decode = time.Since(start)
+		hs := time.Now()
+		p := invoke(handlerFn, request, m, event.Action, prof.Start(id))
+		// Short callbacks are cheaper to wait for than a round trip to CloudFormation
+		for waitLocally(ctx, o.localCallbackDelay, event.Action, p) {
+			// CloudFormation would call back with the model of the progress
+			// event as the desired state
+			if p.ResourceModel != nil {
+				b, err := encoding.Marshal(p.ResourceModel)
+				if err != nil {
+					log.Printf("Unable to call the handler again locally: %v", err)
+					break
+				}
+				body = b
+			}
+			// Each call is a callback attempt of its own
+			rc.Attempt++
+			id = event.correlationID(rc.Attempt)
+			logging.SetCorrelationID(id)
+			m.SetCorrelationID(id)
+			setLogger(rc.Attempt, id)
+			summary.attempt = rc.Attempt
+			span.AddEvent("Local callback", trace.WithAttributes(
+				attribute.Int("cfn.attempt", rc.Attempt),
+				attribute.String("cfn.correlation_id", id),
+			))
+			p = invoke(handlerFn, newRequest(p.CallbackContext, body), m, event.Action, prof.Start(id))
+		}
+		summary.handler = time.Since(hs)
+		if p.OperationStatus == handler.Failed {
+			re.fail(event.Action, cfnerr.New(p.HandlerErrorCode, p.Message, nil))
+		}
+		reportCalls(calls, m, event.Action)
+		if o.permissionCheck {
+			checkPermissions(o.permissions, event.Action, calls.Calls())
+		}
+		pushRuntimeContext(&p, rc)
+		// The operation may have started several callbacks ago
+		if isMutatingAction(event.Action) && (p.OperationStatus == handler.Success || p.OperationStatus == handler.Failed) {
+			m.PublishOperationMetrics(time.Now(), event.Action, string(p.OperationStatus), rc.Attempt, time.Since(rc.Start))
+		}
+		es := time.Now()
 		r, err := newResponse(&p, event.BearerToken)
+		summary.encode = time.Since(es)
 		if err != nil {
 			log.Printf("Error creating response: %v", err)
 			return re.report(event, "Response error", err, unmarshalingError)
@@ -161,8 +328,67 @@ func router(a string, h Handler) (handlerFunc, cfnerr.Error) {
 	}
 }
 
+// reportCalls logs a summary of the AWS API calls made by a handler and
+// publishes their count per operation.
+func reportCalls(r *audit.Recorder, m *metrics.Publisher, action string) {
+	summary := r.Summary()
+
+	var total int
+	for _, s := range summary {
+		total += s.Calls
+		m.PublishAPICallMetric(time.Now(), action, s.Service, s.Operation, float64(s.Calls))
+	}
+	slog.Info("AWS API calls summary", "calls", total, "operations", summary)
+}
+
+// waitLocally waits for the callback of the event when it's delayed by up to
+// maxDelay and the invocation has time left, reporting whether the handler
+// should be called again.
+func waitLocally(ctx context.Context, maxDelay time.Duration, action string, p handler.ProgressEvent) bool {
+	if maxDelay <= 0 || !isMutatingAction(action) || p.OperationStatus != handler.InProgress || p.CallbackDelaySeconds <= 0 {
+		return false
+	}
+
+	d := time.Duration(p.CallbackDelaySeconds) * time.Second
+	deadline, ok := ctx.Deadline()
+	if !ok || d > maxDelay || !scheduler.ComputeLocal(deadline, p.CallbackDelaySeconds) {
+		return false
+	}
+
+	log.Printf("Calling the handler again locally after %v", d)
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// checkPermissions logs the IAM actions used by a handler that the resource
+// schema doesn't declare, and the declared permissions left unused.
+//
+// Without a schema, see WithSchema, there's nothing to check against.
+func checkPermissions(declared map[string][]string, action string, calls []audit.Call) {
+	if declared == nil {
+		slog.Warn("Handler permissions not checked, the resource schema isn't set")
+		return
+	}
+
+	r := audit.CheckPermissions(declared, action, calls)
+	if !r.OK() {
+		slog.Warn("Handler permissions missing from the resource schema", "missing", r.Missing, "used", r.Used)
+	}
+	if len(r.Unused) != 0 {
+		slog.Info("Handler permissions unused by this invocation", "unused", r.Unused)
+	}
+}
+
 // Invoke handles the invocation of the handerFn.
-func invoke(handlerFn handlerFunc, request handler.Request, metricsPublisher *metrics.Publisher, action string) handler.ProgressEvent {
+//
+// The profiling run, nil unless profiling is on, is stopped once the handler returns.
+func invoke(handlerFn handlerFunc, request handler.Request, metricsPublisher *metrics.Publisher, action string, run *profiling.Run) handler.ProgressEvent {
 
 	// Create a channel to received a signal that work is done.
 	ch := make(chan handler.ProgressEvent, 1)
@@ -175,12 +401,12 @@ func invoke(handlerFn handlerFunc, request handler.Request, metricsPublisher *me
 
 		// Report the work is done.
 		pe := handlerFn(request)
-		log.Printf("Received event: %s\nMessage: %s\n",
-			pe.OperationStatus,
-			pe.Message,
-		)
+		slog.Info("Handler returned", "status", pe.OperationStatus, "message", pe.Message)
 		e := time.Since(s)
-		metricsPublisher.PublishDurationMetric(time.Now(), string(action), e.Seconds()*1e3)
+		if err := run.Stop(); err != nil {
+			log.Printf("Unable to write the invocation profile: %v", err)
+		}
+		metricsPublisher.PublishDurationMetric(time.Now(), string(action), e.Seconds()*1e3, pe.HandlerErrorCode)
 		ch <- pe
 	}()
 	return <-ch
@@ -1,23 +1,61 @@
 package cfn
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/audit"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/callback"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/credentials"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/encoding"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/logging"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/metrics"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/profiling"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/tracing/tracingtest"
 	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// TestMain keeps the tests from reaching AWS: the fixtures carry no provider
+// credentials, so real clients would only fail.
+func TestMain(m *testing.M) {
+	os.Setenv(logging.ProviderLogsEnv, "false")
+	os.Setenv(metrics.FormatEnv, string(metrics.FormatText))
+	os.Setenv(callback.EnabledEnv, "false")
+	os.Exit(m.Run())
+}
+
+func TestWithProviderLogs(t *testing.T) {
+	// the option takes precedence over CFN_PROVIDER_LOGS=false
+	if o := newOptions(WithProviderLogs(true)); !o.providerLogs {
+		t.Errorf("Provider logs off; want on")
+	}
+	if o := newOptions(); o.providerLogs {
+		t.Errorf("Provider logs on; want off")
+	}
+}
+
 func TestMakeEventFunc(t *testing.T) {
 	start := time.Now()
 	future := start.Add(time.Minute * 15)
@@ -77,6 +115,7 @@ func TestMakeEventFunc(t *testing.T) {
 		}, false},
 		{"Test CREATE failed", args{&MockHandler{f3}, lc, loadEvent("request.create.json", &event{})}, response{
 			OperationStatus: handler.Failed,
+			Message:         "(ref: 8d969eef6ecad3c2-1)",
 			BearerToken:     "123456",
 		}, false},
 		{"Test simple CREATE async", args{&MockHandler{f2}, lc, loadEvent("request.create.json", &event{})}, response{
@@ -84,6 +123,9 @@ func TestMakeEventFunc(t *testing.T) {
 			Message:              "In Progress",
 			OperationStatus:      handler.InProgress,
 			CallbackDelaySeconds: 130,
+			CallbackContext: map[string]interface{}{
+				runtimeContextKey: map[string]interface{}{"attempt": 1},
+			},
 		}, false},
 		{"Test READ async should return err", args{&MockHandler{f2}, lc, loadEvent("request.read.json", &event{})}, response{
 			OperationStatus: handler.Failed,
@@ -94,10 +136,16 @@ func TestMakeEventFunc(t *testing.T) {
 		{"Test invalid Action", args{&MockHandler{f1}, context.Background(), loadEvent("request.invalid.json", &event{})}, response{
 			OperationStatus: handler.Failed,
 		}, true},
+		{"Test CREATE without caller credentials", args{&MockHandler{f1}, lc, withoutCallerCredentials(loadEvent("request.create.json", &event{}))}, response{
+			OperationStatus: handler.Failed,
+			ErrorCode:       cloudformation.HandlerErrorCodeInvalidCredentials,
+			Message:         "InvalidCredentials: No caller credentials were supplied (ref: 8d969eef6ecad3c2-1)",
+			BearerToken:     "123456",
+		}, false},
 		{"Test wrap panic", args{&MockHandler{f4}, context.Background(), loadEvent("request.create.json", &event{})}, response{
 			OperationStatus: handler.Failed,
 			ErrorCode:       cloudformation.HandlerErrorCodeGeneralServiceException,
-			Message:         "Unable to complete request: error",
+			Message:         "Unable to complete request: error (ref: 8d969eef6ecad3c2-1)",
 			BearerToken:     "123456",
 		}, false},
 	}
@@ -106,6 +154,10 @@ func TestMakeEventFunc(t *testing.T) {
 			f := makeEventFunc(tt.args.h)
 
 			got, err := f(tt.args.ctx, tt.args.event)
+			// the operation start time depends on the clock
+			if rc, ok := got.CallbackContext[runtimeContextKey].(map[string]interface{}); ok {
+				delete(rc, "startTime")
+			}
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("makeEventFunc() = %v, wantErr %v", err, tt.wantErr)
@@ -129,6 +181,12 @@ func TestMakeEventFunc(t *testing.T) {
 	}
 }
 
+// withoutCallerCredentials is a helper function that drops the caller credentials from the event.
+func withoutCallerCredentials(evt *event) *event {
+	evt.RequestData.CallerCredentials = credentials.CloudFormationCredentialsProvider{}
+	return evt
+}
+
 // loadEvent is a helper function that unmarshal the event from a file.
 func loadEvent(path string, evt *event) *event {
 	validevent, err := openFixture(path)
@@ -210,3 +268,567 @@ func TestMakeEventFuncModel(t *testing.T) {
 		})
 	}
 }
+
+func TestMakeEventFuncMetrics(t *testing.T) {
+	sink := metrics.NewMemorySink()
+	h := &MockModelHandler{func(r handler.Request) handler.ProgressEvent {
+		r.Metrics().Count("StabilizationPolls", 2)
+		return handler.ProgressEvent{OperationStatus: handler.Success}
+	}}
+
+	f := makeEventFunc(h, WithMetricsSink(sink))
+	if _, err := f(context.Background(), loadEvent("request.create2.json", &event{})); err != nil {
+		t.Fatalf("makeEventFunc() = %v", err)
+	}
+
+	create := map[string]string{metrics.DimensionKeyAcionType: "CREATE"}
+	if n := sink.Count(metrics.MetricNameHanderInvocationCount, create); n != 1 {
+		t.Errorf("Invocations = %d; want 1", n)
+	}
+	if n := sink.Count(metrics.MetricNameHanderDuration, create); n != 1 {
+		t.Errorf("Durations = %d; want 1", n)
+	}
+	if sum := sink.Sum("StabilizationPolls", create); sum != 2 {
+		t.Errorf("StabilizationPolls = %v; want 2", sum)
+	}
+	if b := sink.Batches(); len(b) != 1 || b[0].CorrelationID != "8d969eef6ecad3c2-1" {
+		t.Errorf("Batches = %+v; want a single batch for 8d969eef6ecad3c2-1", b)
+	}
+}
+
+func TestMakeEventFuncPrometheus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cfn.prom")
+	t.Setenv(metrics.PrometheusPathEnv, path)
+	h := &MockModelHandler{func(r handler.Request) handler.ProgressEvent {
+		return handler.ProgressEvent{OperationStatus: handler.Success}
+	}}
+
+	// the totals are kept between the invocations of a container
+	f := makeEventFunc(h, WithMetricsFormat(metrics.FormatPrometheus))
+	for i := 0; i < 2; i++ {
+		if _, err := f(context.Background(), loadEvent("request.create2.json", &event{})); err != nil {
+			t.Fatalf("makeEventFunc() = %v", err)
+		}
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unable to read the file: %v", err)
+	}
+	if want := `cfn_handler_invocation_count_total{action="CREATE",resource_type="AWS/Test/TestModel"} 2`; !strings.Contains(string(b), want) {
+		t.Errorf("File = %s; want %s", b, want)
+	}
+}
+
+func TestMakeEventFuncExceptionMetrics(t *testing.T) {
+	failed := &MockModelHandler{func(r handler.Request) handler.ProgressEvent {
+		return handler.ProgressEvent{
+			OperationStatus:  handler.Failed,
+			HandlerErrorCode: cloudformation.HandlerErrorCodeNotFound,
+			Message:          "Bucket arn:aws:s3:::pineapple-pizza not found",
+		}
+	}}
+	succeeded := &MockModelHandler{func(r handler.Request) handler.ProgressEvent {
+		return handler.ProgressEvent{OperationStatus: handler.Success}
+	}}
+	// The response of the failure can't be encoded, which is a second error
+	unencodable := &MockModelHandler{func(r handler.Request) handler.ProgressEvent {
+		return handler.ProgressEvent{
+			OperationStatus:  handler.Failed,
+			HandlerErrorCode: cloudformation.HandlerErrorCodeNotFound,
+			ResourceModel:    func() {},
+		}
+	}}
+
+	tests := []struct {
+		name          string
+		h             Handler
+		event         *event
+		wantException string
+		wantErrorCode string
+	}{
+		{"Handler failure", failed, loadEvent("request.create2.json", &event{}), cloudformation.HandlerErrorCodeNotFound, cloudformation.HandlerErrorCodeNotFound},
+		{"Handler success", succeeded, loadEvent("request.create2.json", &event{}), "", metrics.HandlerErrorCodeNone},
+		{"Invalid action", succeeded, loadEvent("request.invalid.json", &event{}), invalidRequestError, ""},
+		{"Missing caller credentials", succeeded, withoutCallerCredentials(loadEvent("request.create2.json", &event{})), cloudformation.HandlerErrorCodeInvalidCredentials, ""},
+		{"Unencodable failure", unencodable, loadEvent("request.create2.json", &event{}), unmarshalingError, cloudformation.HandlerErrorCodeNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Binding the provider logs fails without credentials, which is an exception too
+			t.Setenv(logging.ProviderLogsEnv, "false")
+			sink := metrics.NewMemorySink()
+			f := makeEventFunc(tt.h, WithMetricsSink(sink))
+			_, _ = f(context.Background(), tt.event)
+
+			exceptions := sink.Find(metrics.MetricNameHanderException, nil)
+			switch {
+			case len(tt.wantException) == 0 && len(exceptions) != 0:
+				t.Errorf("Exceptions = %+v; want none", exceptions)
+			case len(tt.wantException) != 0 && (sink.Count(metrics.MetricNameHanderException, nil) != 1 || exceptions[0].Dimensions[metrics.DimensionKeyExceptionType] != tt.wantException):
+				t.Errorf("Exceptions = %+v; want one %s", exceptions, tt.wantException)
+			}
+
+			durations := sink.Find(metrics.MetricNameHanderDuration, nil)
+			switch {
+			case len(tt.wantErrorCode) == 0 && len(durations) != 0:
+				t.Errorf("Durations = %+v; want none", durations)
+			case len(tt.wantErrorCode) != 0 && (len(durations) != 1 || durations[0].Dimensions[metrics.DimensionKeyHandlerErrorCode] != tt.wantErrorCode):
+				t.Errorf("Durations = %+v; want one with %s", durations, tt.wantErrorCode)
+			}
+		})
+	}
+}
+
+func TestMakeEventFuncOperationMetrics(t *testing.T) {
+	h := func(status handler.Status) Handler {
+		return &MockModelHandler{func(r handler.Request) handler.ProgressEvent {
+			return handler.ProgressEvent{OperationStatus: status, CallbackDelaySeconds: 5}
+		}}
+	}
+	// the third callback of an operation that started a minute ago
+	callback := func() *event {
+		evt := loadEvent("request.create2.json", &event{})
+		evt.CallbackContext = map[string]interface{}{
+			runtimeContextKey: map[string]interface{}{
+				"attempt":   float64(3),
+				"startTime": float64(time.Now().Add(-time.Minute).UnixMilli()),
+			},
+		}
+		return evt
+	}
+
+	tests := []struct {
+		name       string
+		h          Handler
+		event      *event
+		wantStatus string
+	}{
+		{"Stabilized", h(handler.Success), callback(), "SUCCESS"},
+		{"Failed", h(handler.Failed), callback(), "FAILED"},
+		{"In progress", h(handler.InProgress), callback(), ""},
+		{"Read", h(handler.Success), loadEvent("request.read.json", &event{}), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := metrics.NewMemorySink()
+			f := makeEventFunc(tt.h, WithMetricsSink(sink))
+			if _, err := f(context.Background(), tt.event); err != nil {
+				t.Fatalf("makeEventFunc() = %v", err)
+			}
+
+			if len(tt.wantStatus) == 0 {
+				if m := sink.Find(metrics.MetricNameOperationStatus, nil); len(m) != 0 {
+					t.Errorf("OperationStatus = %+v; want none", m)
+				}
+				return
+			}
+
+			status := map[string]string{metrics.DimensionKeyOperationStatus: tt.wantStatus}
+			if n := sink.Count(metrics.MetricNameOperationStatus, status); n != 1 {
+				t.Errorf("OperationStatus = %d; want 1", n)
+			}
+			if n := sink.Sum(metrics.MetricNameOperationAttempts, status); n != 4 {
+				t.Errorf("OperationAttempts = %v; want 4", n)
+			}
+			if d := sink.Sum(metrics.MetricNameOperationDuration, status); d < 60000 {
+				t.Errorf("OperationDuration = %v; want at least a minute", d)
+			}
+		})
+	}
+}
+
+func TestMakeEventFuncTracing(t *testing.T) {
+	exp := tracingtest.NewMemoryExporter()
+	var handlerSpans []trace.SpanContext
+	h := &MockModelHandler{func(r handler.Request) handler.ProgressEvent {
+		handlerSpans = append(handlerSpans, trace.SpanContextFromContext(r.Context()))
+		if len(r.CallbackContext) == 0 {
+			return handler.ProgressEvent{
+				OperationStatus:      handler.InProgress,
+				CallbackDelaySeconds: 5,
+				CallbackContext:      map[string]interface{}{"polls": 1},
+			}
+		}
+		return handler.ProgressEvent{OperationStatus: handler.Failed, HandlerErrorCode: cloudformation.HandlerErrorCodeNotStabilized}
+	}}
+	f := makeEventFunc(h, WithTracing(exp), WithMetricsSink(metrics.NewMemorySink()))
+
+	// the callback context of the first invocation is sent back with the second
+	first, err := f(context.Background(), loadEvent("request.create2.json", &event{}))
+	if err != nil {
+		t.Fatalf("makeEventFunc() = %v", err)
+	}
+	callback := loadEvent("request.create2.json", &event{})
+	b, _ := json.Marshal(first.CallbackContext)
+	if err := json.Unmarshal(b, &callback.CallbackContext); err != nil {
+		t.Fatalf("Unable to decode the callback context: %v", err)
+	}
+	if _, err := f(context.Background(), callback); err != nil {
+		t.Fatalf("makeEventFunc() = %v", err)
+	}
+
+	spans := exp.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	if spans[0].Name != "CloudFormation CREATE" || spans[1].SpanContext.TraceID() != spans[0].SpanContext.TraceID() {
+		t.Errorf("Invocations of an operation should share a trace")
+	}
+	for i, s := range spans {
+		if handlerSpans[i].SpanID() != s.SpanContext.SpanID() {
+			t.Errorf("Handler %d should run in the span of its invocation", i)
+		}
+	}
+
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, a := range spans[1].Attributes {
+		attrs[a.Key] = a.Value
+	}
+	if attrs["cfn.operation_status"].AsString() != "FAILED" || attrs["cfn.attempt"].AsInt64() != 2 || attrs["cfn.logical_resource_id"].AsString() != "myBucket" {
+		t.Errorf("Attributes = %v", attrs)
+	}
+	if spans[1].Status.Code != codes.Error {
+		t.Errorf("Status = %v; want an error", spans[1].Status)
+	}
+}
+
+// throttlingTransport answers every request with a CloudFormation throttling error.
+type throttlingTransport struct{}
+
+func (throttlingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusBadRequest,
+		Header:     http.Header{"Content-Type": []string{"text/xml"}},
+		Body:       io.NopCloser(strings.NewReader(`<ErrorResponse><Error><Code>Throttling</Code></Error><RequestId>req-1</RequestId></ErrorResponse>`)),
+		Request:    r,
+	}, nil
+}
+
+func TestMakeEventFuncAudit(t *testing.T) {
+	h := &MockModelHandler{func(r handler.Request) handler.ProgressEvent {
+		sess := r.Session.Copy(&aws.Config{
+			HTTPClient: &http.Client{Transport: throttlingTransport{}},
+			MaxRetries: aws.Int(0),
+		})
+		svc := cloudformation.New(sess)
+		for i := 0; i < 2; i++ {
+			_, _ = svc.ListStacks(&cloudformation.ListStacksInput{})
+		}
+		return handler.ProgressEvent{OperationStatus: handler.Success}
+	}}
+
+	sink := metrics.NewMemorySink()
+	f := makeEventFunc(h, WithMetricsSink(sink))
+	if _, err := f(context.Background(), loadEvent("request.create2.json", &event{})); err != nil {
+		t.Fatalf("makeEventFunc() = %v", err)
+	}
+
+	listStacks := map[string]string{
+		metrics.DimensionKeyAcionType: "CREATE",
+		metrics.DimensionKeyService:   "CloudFormation",
+		metrics.DimensionKeyOperation: "ListStacks",
+	}
+	if n := sink.Sum(metrics.MetricNameAPICallCount, listStacks); n != 2 {
+		t.Errorf("API calls = %v; want 2", n)
+	}
+}
+
+func TestCheckPermissions(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	o := newOptions(WithSchema([]byte(`{
+		"typeName": "Foo::Bar::Baz",
+		"properties": {},
+		"handlers": {"create": {"permissions": ["cloudformation:ListStacks", "s3:CreateBucket"]}}
+	}`)), WithPermissionCheck(true))
+	if !o.permissionCheck {
+		t.Fatalf("Expected the permission check to be on")
+	}
+
+	checkPermissions(o.permissions, "CREATE", []audit.Call{
+		{Service: "CloudFormation", Operation: "ListStacks"},
+		{Service: "CloudFormation", Operation: "DescribeStacks"},
+	})
+
+	out := buf.String()
+	for _, want := range []string{
+		`"msg":"Handler permissions missing from the resource schema","missing":["cloudformation:DescribeStacks"]`,
+		`"msg":"Handler permissions unused by this invocation","unused":["s3:CreateBucket"]`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected the logs to contain %s, got %s", want, out)
+		}
+	}
+}
+
+func TestCheckPermissionsWithoutSchema(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	o := newOptions(WithPermissionCheck(true))
+	checkPermissions(o.permissions, "CREATE", []audit.Call{{Service: "S3", Operation: "CreateBucket"}})
+
+	if out := buf.String(); strings.Contains(out, "missing") || !strings.Contains(out, "Handler permissions not checked") {
+		t.Errorf("Logs = %s; want the check skipped", out)
+	}
+}
+
+// failingSink fails to write every batch.
+type failingSink struct{}
+
+func (failingSink) Write(ctx context.Context, b metrics.Batch) error {
+	return errors.New("no route to host")
+}
+
+func TestMakeEventFuncSummary(t *testing.T) {
+	t.Setenv(logging.ProviderLogsEnv, "false")
+	var buf bytes.Buffer
+	logging.SetProviderLogOutput(&buf)
+	defer logging.SetProviderLogOutput(os.Stderr)
+
+	h := &MockModelHandler{func(r handler.Request) handler.ProgressEvent {
+		return handler.ProgressEvent{
+			OperationStatus:      handler.InProgress,
+			CallbackDelaySeconds: 5,
+			ResourceModel:        map[string]interface{}{"BucketName": "my-bucket"},
+		}
+	}}
+
+	tests := []struct {
+		name      string
+		sink      metrics.Sink
+		wantFlush string
+	}{
+		{"Metrics sent", metrics.NewMemorySink(), metricsFlushOK},
+		{"Metrics failed", failingSink{}, metricsFlushFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			f := makeEventFunc(h, WithMetricsSink(tt.sink))
+			if _, err := f(context.Background(), loadEvent("request.create2.json", &event{})); err != nil {
+				t.Fatalf("makeEventFunc() = %v", err)
+			}
+
+			var summary struct {
+				Invocation struct {
+					Action               string
+					Status               string
+					ErrorCode            string
+					Attempt              int
+					DurationMs           *int64
+					DecodeMs             *int64
+					HandlerMs            *int64
+					EncodeMs             *int64
+					CallbackDelaySeconds int64
+					ModelBytes           int
+					MetricsFlush         string
+				}
+			}
+			for _, line := range strings.Split(buf.String(), "\n") {
+				if i := strings.Index(line, "{"); i >= 0 && strings.Contains(line, summaryMessage) {
+					if err := json.Unmarshal([]byte(line[i:]), &summary); err != nil {
+						t.Fatalf("Unable to read the summary %s: %v", line, err)
+					}
+				}
+			}
+
+			got := summary.Invocation
+			if got.Action != "CREATE" || got.Status != "IN_PROGRESS" || got.Attempt != 1 || got.CallbackDelaySeconds != 5 {
+				t.Errorf("Summary = %+v", got)
+			}
+			if got.DurationMs == nil || got.DecodeMs == nil || got.HandlerMs == nil || got.EncodeMs == nil {
+				t.Errorf("Summary = %+v; want the durations", got)
+			}
+			if want := len(`{"BucketName":"my-bucket"}`); got.ModelBytes != want {
+				t.Errorf("ModelBytes = %v; want %v", got.ModelBytes, want)
+			}
+			if got.MetricsFlush != tt.wantFlush {
+				t.Errorf("MetricsFlush = %q; want %q", got.MetricsFlush, tt.wantFlush)
+			}
+		})
+	}
+}
+
+func TestMakeEventFuncProfiling(t *testing.T) {
+	h := &MockModelHandler{func(r handler.Request) handler.ProgressEvent {
+		return handler.ProgressEvent{OperationStatus: handler.Success}
+	}}
+
+	t.Run("Dir", func(t *testing.T) {
+		dir := t.TempDir()
+		f := makeEventFunc(h, WithMetricsSink(metrics.NewMemorySink()), WithProfiling(0, profiling.NewDirSink(dir)))
+		if _, err := f(context.Background(), loadEvent("request.create2.json", &event{})); err != nil {
+			t.Fatalf("makeEventFunc() = %v", err)
+		}
+
+		for _, name := range []string{"8d969eef6ecad3c2-1.cpu.pprof", "8d969eef6ecad3c2-1.heap.pprof"} {
+			if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+				t.Errorf("Expected the profile %s: %v", name, err)
+			}
+		}
+	})
+
+	t.Run("Provider logs", func(t *testing.T) {
+		t.Setenv(logging.ProviderLogsEnv, "false")
+		// the provider log writer falls back to stdout
+		out, err := os.CreateTemp(t.TempDir(), "stdout")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func(stdout *os.File) { os.Stdout = stdout }(os.Stdout)
+		os.Stdout = out
+
+		f := makeEventFunc(h, WithMetricsSink(metrics.NewMemorySink()), WithProfiling(0, nil))
+		if _, err := f(context.Background(), loadEvent("request.create2.json", &event{})); err != nil {
+			t.Fatalf("makeEventFunc() = %v", err)
+		}
+
+		b, err := os.ReadFile(out.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the chunks aren't redacted, so they decode to the gzipped profiles
+		profiles := map[string][]byte{}
+		for _, line := range strings.Split(string(b), "\n") {
+			var rec struct {
+				Msg     string
+				Profile string
+				Data    string
+			}
+			if json.Unmarshal([]byte(line), &rec) != nil || rec.Msg != "Profile chunk" {
+				continue
+			}
+			chunk, err := base64.StdEncoding.DecodeString(rec.Data)
+			if err != nil {
+				t.Fatalf("Invalid chunk of the %s profile: %v", rec.Profile, err)
+			}
+			profiles[rec.Profile] = append(profiles[rec.Profile], chunk...)
+		}
+		for _, name := range []string{profiling.CPU, profiling.Heap} {
+			if p := profiles[name]; len(p) < 2 || p[0] != 0x1f || p[1] != 0x8b {
+				t.Errorf("The %s profile isn't gzipped pprof data", name)
+			}
+		}
+	})
+}
+
+func TestMakeEventFuncReportProgress(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "progress.jsonl")
+	t.Setenv(callback.FileEnv, name)
+
+	var reportErr error
+	h := &MockModelHandler{func(r handler.Request) handler.ProgressEvent {
+		reportErr = r.ReportProgress("Waiting for the bucket", nil)
+		return handler.ProgressEvent{OperationStatus: handler.InProgress, CallbackDelaySeconds: 5}
+	}}
+
+	f := makeEventFunc(h, WithMetricsSink(metrics.NewMemorySink()))
+	if _, err := f(context.Background(), loadEvent("request.create2.json", &event{})); err != nil {
+		t.Fatalf("makeEventFunc() = %v", err)
+	}
+	if reportErr != nil {
+		t.Fatalf("ReportProgress() = %v", reportErr)
+	}
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r callback.Report
+	if err := json.Unmarshal(b, &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.BearerToken != "123456" || r.OperationStatus != "IN_PROGRESS" || r.StatusMessage != "Waiting for the bucket" {
+		t.Errorf("Report = %+v", r)
+	}
+}
+
+func TestMakeEventFuncLocalCallbacks(t *testing.T) {
+	type call struct {
+		callbackContext map[string]interface{}
+		correlationID   string
+		model           MockModel
+	}
+	// the handler stabilizes on its third call, updating the model on each
+	newHandler := func(calls *[]call) Handler {
+		return &MockModelHandler{func(r handler.Request) handler.ProgressEvent {
+			c := call{callbackContext: r.CallbackContext, correlationID: logging.CorrelationID()}
+			if err := r.Unmarshal(&c.model); err != nil {
+				t.Errorf("Unmarshal() = %v", err)
+			}
+			*calls = append(*calls, c)
+
+			model := &MockModel{Property1: c.model.Property1, Property2: aws.String(strconv.Itoa(len(*calls)))}
+			if len(*calls) == 3 {
+				return handler.ProgressEvent{OperationStatus: handler.Success, ResourceModel: model}
+			}
+			return handler.ProgressEvent{
+				OperationStatus:      handler.InProgress,
+				CallbackDelaySeconds: 1,
+				CallbackContext:      map[string]interface{}{"calls": len(*calls)},
+				ResourceModel:        model,
+			}
+		}}
+	}
+
+	tests := []struct {
+		name       string
+		maxDelay   time.Duration
+		timeLeft   time.Duration
+		wantStatus handler.Status
+		wantCalls  int
+	}{
+		{"Waited locally", 5 * time.Second, time.Minute, handler.Success, 3},
+		{"Off", 0, time.Minute, handler.InProgress, 1},
+		{"Delay too long", 500 * time.Millisecond, time.Minute, handler.InProgress, 1},
+		{"Time running low", 5 * time.Second, time.Second, handler.InProgress, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []call
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeLeft)
+			defer cancel()
+
+			f := makeEventFunc(newHandler(&calls), WithMetricsSink(metrics.NewMemorySink()), WithLocalCallbacks(tt.maxDelay))
+			resp, err := f(ctx, loadEvent("request.create2.json", &event{}))
+			if err != nil {
+				t.Fatalf("makeEventFunc() = %v", err)
+			}
+
+			if resp.OperationStatus != tt.wantStatus || len(calls) != tt.wantCalls {
+				t.Fatalf("Response = %v after %d calls; want %v after %d", resp.OperationStatus, len(calls), tt.wantStatus, tt.wantCalls)
+			}
+			for i, c := range calls {
+				// each call is an attempt of its own
+				if want := fmt.Sprintf("8d969eef6ecad3c2-%d", i+1); c.correlationID != want {
+					t.Errorf("Correlation ID of call %d = %q; want %q", i+1, c.correlationID, want)
+				}
+				if aws.StringValue(c.model.Property1) != "abc" {
+					t.Errorf("Model of call %d = %+v", i+1, c.model)
+				}
+				if i == 0 {
+					continue
+				}
+				// and gets the callback context and the model returned by the previous one
+				if c.callbackContext["calls"] != i {
+					t.Errorf("Callback context of call %d = %v", i+1, c.callbackContext)
+				}
+				if want := strconv.Itoa(i); aws.StringValue(c.model.Property2) != want {
+					t.Errorf("Model of call %d = %+v; want Property2 %q", i+1, c.model, want)
+				}
+			}
+			// CloudFormation calls back with the attempt after the last local one
+			if resp.OperationStatus == handler.InProgress {
+				state, _ := resp.CallbackContext[runtimeContextKey].(map[string]interface{})
+				if state["attempt"] != len(calls) {
+					t.Errorf("Runtime context = %v; want attempt %d", state, len(calls))
+				}
+			}
+		})
+	}
+}
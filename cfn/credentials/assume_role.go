@@ -0,0 +1,173 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/cfnerr"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// maxRoleSessionNameLength is the IAM limit on role session names.
+const maxRoleSessionNameLength = 64
+
+// defaultRoleSessionName is used when no stack or logical ID is available.
+const defaultRoleSessionName = "CloudFormationResourceProvider"
+
+// invalidRoleSessionChars matches characters IAM doesn't allow in a role session name.
+var invalidRoleSessionChars = regexp.MustCompile(`[^\w+=,.@-]`)
+
+// RoleSessionName derives an IAM role session name from a stack ID and logical ID
+//
+// The name shows up in CloudTrail so calls made with an assumed role
+// can be attributed to the stack and resource that made them.
+//
+//	// Will return "MyStack-MyBucket"
+//	credentials.RoleSessionName("arn:aws:cloudformation:us-east-1:123456789012:stack/MyStack/1a2b", "MyBucket")
+func RoleSessionName(stackID string, logicalID string) string {
+	var parts []string
+	for _, p := range []string{StackName(stackID), logicalID} {
+		if p = invalidRoleSessionChars.ReplaceAllString(p, ""); len(p) != 0 {
+			parts = append(parts, p)
+		}
+	}
+
+	name := strings.Join(parts, "-")
+	if len(name) < 2 {
+		return defaultRoleSessionName
+	}
+
+	if len(name) > maxRoleSessionNameLength {
+		name = name[:maxRoleSessionNameLength]
+	}
+
+	return name
+}
+
+// StackName returns the name of a stack from its ID, an ARN of the form
+// arn:...:stack/<name>/<guid>, or the ID itself when it isn't one.
+func StackName(stackID string) string {
+	if parts := strings.Split(stackID, "/"); len(parts) > 1 {
+		return parts[1]
+	}
+
+	return stackID
+}
+
+// AssumeRoleSession returns a session for roleArn in region, assumed using the
+// credentials of base, with the default role session name.
+//
+// The session isn't cached. Handlers should use Request.AssumeRoleSession, which
+// caches sessions for the invocation and names them after the stack and logical
+// ID for CloudTrail; see AssumeRoleCache to do the same outside a handler.
+func AssumeRoleSession(base *session.Session, roleArn string, externalID string, region string) (*session.Session, error) {
+	return NewAssumeRoleCache(defaultRoleSessionName).AssumeRoleSession(base, roleArn, externalID, region)
+}
+
+// AssumeRoleCache caches the sessions of assumed roles.
+//
+// A cache is meant to live for a single invocation, so each role is assumed at most
+// once per invocation no matter how many times the handler asks for it.
+type AssumeRoleCache struct {
+	sessionName string
+
+	mu       sync.Mutex
+	sessions map[string]*session.Session
+
+	// newClient creates the STS client used to assume roles.
+	newClient func(p client.ConfigProvider, region string) stscreds.AssumeRoler
+}
+
+// NewAssumeRoleCache creates an AssumeRoleCache that assumes roles with the
+// supplied role session name, see RoleSessionName.
+func NewAssumeRoleCache(sessionName string) *AssumeRoleCache {
+	return &AssumeRoleCache{
+		sessionName: sessionName,
+		sessions:    map[string]*session.Session{},
+		newClient: func(p client.ConfigProvider, region string) stscreds.AssumeRoler {
+			return sts.New(p, aws.NewConfig().WithRegion(region))
+		},
+	}
+}
+
+// AssumeRoleSession returns a session for roleArn in region, assumed
+// using the credentials of base.
+//
+// If region is empty, the region of base is used. The external ID is optional.
+// Failures to assume the role are returned as a cfnerr.Error with an
+// AccessDenied or InvalidCredentials handler error code, or with Throttling,
+// NetworkFailure or ServiceInternalError for transient failures.
+func (c *AssumeRoleCache) AssumeRoleSession(base *session.Session, roleArn string, externalID string, region string) (*session.Session, error) {
+	if base == nil {
+		return nil, cfnerr.New(InvalidSessionError, "No session to assume the role with", nil)
+	}
+
+	if len(region) == 0 {
+		region = aws.StringValue(base.Config.Region)
+	}
+
+	key := fmt.Sprintf("%s|%s|%s", roleArn, externalID, region)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if sess, ok := c.sessions[key]; ok {
+		return sess, nil
+	}
+
+	creds := stscreds.NewCredentialsWithClient(c.newClient(base, region), roleArn, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = c.sessionName
+		if len(externalID) != 0 {
+			p.ExternalID = aws.String(externalID)
+		}
+	})
+
+	// assume the role now so failures surface here rather than on first use
+	if _, err := creds.Get(); err != nil {
+		return nil, assumeRoleError(roleArn, err)
+	}
+
+	sess := base.Copy(&aws.Config{
+		Credentials: creds,
+		Region:      aws.String(region),
+	})
+	c.sessions[key] = sess
+
+	return sess, nil
+}
+
+// assumeRoleError maps an STS error to a handler error code.
+//
+// Only errors about the credentials themselves are InvalidCredentials; throttling
+// and network failures are transient, and anything else is blamed on the service.
+func assumeRoleError(roleArn string, err error) error {
+	code := cloudformation.HandlerErrorCodeServiceInternalError
+
+	var aerr awserr.Error
+	switch {
+	case request.IsErrorThrottle(err):
+		code = cloudformation.HandlerErrorCodeThrottling
+	case errors.As(err, &aerr):
+		switch aerr.Code() {
+		case "AccessDenied", sts.ErrCodeRegionDisabledException:
+			code = cloudformation.HandlerErrorCodeAccessDenied
+		case sts.ErrCodeExpiredTokenException, "InvalidClientTokenId", "UnrecognizedClientException",
+			"SignatureDoesNotMatch", "IncompleteSignature", "MissingAuthenticationToken", "NoCredentialProviders":
+			code = cloudformation.HandlerErrorCodeInvalidCredentials
+		case request.ErrCodeRequestError, request.ErrCodeResponseTimeout, request.CanceledErrorCode:
+			code = cloudformation.HandlerErrorCodeNetworkFailure
+		}
+	}
+
+	return cfnerr.New(code, fmt.Sprintf("Unable to assume role %s", roleArn), err)
+}
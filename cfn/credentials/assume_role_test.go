@@ -0,0 +1,166 @@
+package credentials
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/cfnerr"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+type MockAssumeRoler struct {
+	err   error
+	calls int
+	input *sts.AssumeRoleInput
+}
+
+func (m *MockAssumeRoler) AssumeRole(in *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	m.calls++
+	m.input = in
+
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &sts.AssumeRoleOutput{
+		Credentials: &sts.Credentials{
+			AccessKeyId:     aws.String("x"),
+			SecretAccessKey: aws.String("y"),
+			SessionToken:    aws.String("z"),
+			Expiration:      aws.Time(time.Now().Add(time.Hour)),
+		},
+	}, nil
+}
+
+func newMockAssumeRoleCache(m *MockAssumeRoler) *AssumeRoleCache {
+	c := NewAssumeRoleCache("MyStack-MyBucket")
+	c.newClient = func(p client.ConfigProvider, region string) stscreds.AssumeRoler {
+		return m
+	}
+	return c
+}
+
+func TestRoleSessionName(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		stackID   string
+		logicalID string
+		want      string
+	}{
+		{"Stack ARN", "arn:aws:cloudformation:us-east-1:123456789012:stack/MyStack/1a2b", "MyBucket", "MyStack-MyBucket"},
+		{"No Stack", "", "MyBucket", "MyBucket"},
+		{"Empty", "", "", defaultRoleSessionName},
+		{"Invalid Characters", "", "My Bucket!", "MyBucket"},
+		{"Too Long", "", "ThisIsAVeryLongLogicalIdentifierThatGoesWellBeyondTheSixtyFourCharacterLimit", "ThisIsAVeryLongLogicalIdentifierThatGoesWellBeyondTheSixtyFourCh"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RoleSessionName(tt.stackID, tt.logicalID); got != tt.want {
+				t.Errorf("RoleSessionName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStackName(t *testing.T) {
+	for id, want := range map[string]string{
+		"arn:aws:cloudformation:us-east-1:123456789012:stack/MyStack/1a2b": "MyStack",
+		"MyStack": "MyStack",
+		"":        "",
+	} {
+		if got := StackName(id); got != want {
+			t.Errorf("StackName(%q) = %q; want %q", id, got, want)
+		}
+	}
+}
+
+func TestAssumeRoleSession(t *testing.T) {
+	base := SessionFromCredentialsProvider(NewProvider("a", "b", "c"), &aws.Config{Region: aws.String("us-east-1")})
+
+	t.Run("Cached", func(t *testing.T) {
+		m := &MockAssumeRoler{}
+		c := newMockAssumeRoleCache(m)
+
+		sess, err := c.AssumeRoleSession(base, "arn:aws:iam::123456789012:role/Other", "ext", "eu-west-1")
+		if err != nil {
+			t.Fatalf("Unable to assume role: %v", err)
+		}
+		if aws.StringValue(sess.Config.Region) != "eu-west-1" {
+			t.Fatalf("Incorrect region: %v", aws.StringValue(sess.Config.Region))
+		}
+		if aws.StringValue(m.input.RoleSessionName) != "MyStack-MyBucket" || aws.StringValue(m.input.ExternalId) != "ext" {
+			t.Fatalf("Incorrect assume role input: %v", m.input)
+		}
+
+		val, err := sess.Config.Credentials.Get()
+		if err != nil || val.AccessKeyID != "x" {
+			t.Fatalf("Session doesn't use the assumed role: %v %v", val, err)
+		}
+
+		again, err := c.AssumeRoleSession(base, "arn:aws:iam::123456789012:role/Other", "ext", "eu-west-1")
+		if err != nil {
+			t.Fatalf("Unable to assume role: %v", err)
+		}
+		if again != sess || m.calls != 1 {
+			t.Fatalf("Session wasn't cached, %d calls", m.calls)
+		}
+	})
+
+	t.Run("Default Region", func(t *testing.T) {
+		c := newMockAssumeRoleCache(&MockAssumeRoler{})
+
+		sess, err := c.AssumeRoleSession(base, "arn:aws:iam::123456789012:role/Other", "", "")
+		if err != nil {
+			t.Fatalf("Unable to assume role: %v", err)
+		}
+		if aws.StringValue(sess.Config.Region) != "us-east-1" {
+			t.Fatalf("Incorrect region: %v", aws.StringValue(sess.Config.Region))
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		for _, tt := range []struct {
+			name string
+			err  error
+			want string
+		}{
+			{"AccessDenied", awserr.New("AccessDenied", "not authorized", nil), cloudformation.HandlerErrorCodeAccessDenied},
+			{"RegionDisabled", awserr.New(sts.ErrCodeRegionDisabledException, "disabled", nil), cloudformation.HandlerErrorCodeAccessDenied},
+			{"ExpiredToken", awserr.New(sts.ErrCodeExpiredTokenException, "expired", nil), cloudformation.HandlerErrorCodeInvalidCredentials},
+			{"InvalidClientTokenId", awserr.New("InvalidClientTokenId", "invalid", nil), cloudformation.HandlerErrorCodeInvalidCredentials},
+			{"Throttling", awserr.New("Throttling", "rate exceeded", nil), cloudformation.HandlerErrorCodeThrottling},
+			{"Network", awserr.New(request.ErrCodeRequestError, "send request failed", errors.New("connection reset")), cloudformation.HandlerErrorCodeNetworkFailure},
+			{"Server", awserr.NewRequestFailure(awserr.New("InternalFailure", "internal", nil), 500, "req-1"), cloudformation.HandlerErrorCodeServiceInternalError},
+			{"Other", errors.New("boom"), cloudformation.HandlerErrorCodeServiceInternalError},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				c := newMockAssumeRoleCache(&MockAssumeRoler{err: tt.err})
+
+				_, err := c.AssumeRoleSession(base, "arn:aws:iam::123456789012:role/Other", "", "")
+				cerr, ok := err.(cfnerr.Error)
+				if !ok {
+					t.Fatalf("Expected a cfnerr.Error: %v", err)
+				}
+				if cerr.Code() != tt.want {
+					t.Fatalf("Incorrect error code: %v, want %v", cerr.Code(), tt.want)
+				}
+			})
+		}
+	})
+
+	t.Run("No Session", func(t *testing.T) {
+		c := NewAssumeRoleCache("foo")
+		if _, err := c.AssumeRoleSession(nil, "arn:aws:iam::123456789012:role/Other", "", ""); err == nil {
+			t.Fatalf("Error not returned")
+		}
+		if _, err := AssumeRoleSession(nil, "arn:aws:iam::123456789012:role/Other", "", ""); err == nil {
+			t.Fatalf("Error not returned")
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package credentials
+
+import (
+	"context"
+	"strings"
+
+	awsv2 "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// sdkEndpointIDs maps the AWS SDK for Go v2 service IDs whose endpoint ID
+// can't be derived from the service ID alone.
+var sdkEndpointIDs = map[string]string{
+	"CloudWatch":        "monitoring",
+	"CloudWatch Logs":   "logs",
+	"CloudWatch Events": "events",
+	"EventBridge":       "events",
+}
+
+// ConfigFromCredentialsProvider creates an AWS SDK for Go v2 config from a credentials provider
+//
+// It is the v2 counterpart of SessionFromCredentialsProvider; clients created from the config
+// use the same credentials and endpoint overrides as the session.
+func ConfigFromCredentialsProvider(provider credentials.Provider, region string, e Endpoints) awsv2.Config {
+	return newConfig(credentials.NewCredentials(provider), region, e)
+}
+
+// ConfigFromSession creates an AWS SDK for Go v2 config sharing the credentials and
+// endpoint overrides of an SDK v1 session.
+//
+// If region is empty, the session's region is used.
+func ConfigFromSession(sess *session.Session, region string) awsv2.Config {
+	if sess == nil {
+		return awsv2.Config{Region: region}
+	}
+
+	if len(region) == 0 {
+		region = aws.StringValue(sess.Config.Region)
+	}
+
+	e, _ := sess.Config.EndpointResolver.(Endpoints)
+
+	return newConfig(sess.Config.Credentials, region, e)
+}
+
+func newConfig(creds *credentials.Credentials, region string, e Endpoints) awsv2.Config {
+	cfg := awsv2.Config{
+		Region: region,
+	}
+
+	if creds != nil {
+		cfg.Credentials = v2Credentials{creds: creds}
+	}
+
+	if !e.IsZero() {
+		cfg.ConfigSources = append(cfg.ConfigSources, e)
+	}
+
+	return cfg
+}
+
+// GetServiceBaseEndpoint allows Endpoints to be used as an SDK v2 config source,
+// resolving the endpoint override of a service from its SDK ID.
+func (e Endpoints) GetServiceBaseEndpoint(ctx context.Context, sdkID string) (string, bool, error) {
+	id, ok := sdkEndpointIDs[sdkID]
+	if !ok {
+		id = strings.ToLower(strings.ReplaceAll(sdkID, " ", ""))
+	}
+
+	u, ok := e.URL(id)
+	return u, ok, nil
+}
+
+// v2Credentials adapts SDK v1 credentials to the SDK v2 CredentialsProvider interface.
+type v2Credentials struct {
+	creds *credentials.Credentials
+}
+
+// Retrieve returns the credentials held by the SDK v1 credentials.
+func (c v2Credentials) Retrieve(ctx context.Context) (awsv2.Credentials, error) {
+	v, err := c.creds.GetWithContext(ctx)
+	if err != nil {
+		return awsv2.Credentials{}, err
+	}
+
+	out := awsv2.Credentials{
+		AccessKeyID:     v.AccessKeyID,
+		SecretAccessKey: v.SecretAccessKey,
+		SessionToken:    v.SessionToken,
+		Source:          v.ProviderName,
+	}
+
+	// ExpiresAt errors or returns the zero time when the underlying provider can't expire
+	if t, err := c.creds.ExpiresAt(); err == nil && !t.IsZero() {
+		out.CanExpire = true
+		out.Expires = t
+	}
+
+	return out, nil
+}
@@ -5,9 +5,14 @@ passed in to resource providers from CloudFormation.
 package credentials
 
 import (
+	"encoding/json"
+	"time"
+
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/cfnerr"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
 )
 
 // CloudFormationCredentialsProviderName ...
@@ -15,12 +20,20 @@ const CloudFormationCredentialsProviderName = "CloudFormationCredentialsProvider
 
 const InvalidSessionError = "InvalidSession"
 
+// CredentialsTTL is how long credentials are considered valid after
+// they're received when CloudFormation doesn't supply an expiration.
+// It only applies to providers created by NewProvider or decoded from JSON.
+//
+// It is deliberately conservative; it matches the maximum Lambda timeout.
+const CredentialsTTL = 15 * time.Minute
+
 // NewProvider ...
 func NewProvider(accessKeyID string, secretAccessKey string, sessionToken string) credentials.Provider {
 	return &CloudFormationCredentialsProvider{
 		AccessKeyID:     accessKeyID,
 		SecretAccessKey: secretAccessKey,
 		SessionToken:    sessionToken,
+		received:        time.Now(),
 	}
 }
 
@@ -36,12 +49,50 @@ type CloudFormationCredentialsProvider struct {
 
 	// SessionToken ...
 	SessionToken string `json:"sessionToken"`
+
+	// Expiration is when the credentials expire, if supplied by CloudFormation.
+	Expiration *time.Time `json:"expiration,omitempty"`
+
+	// received is when the credentials were received, used to apply CredentialsTTL.
+	received time.Time
+}
+
+// UnmarshalJSON records when the credentials were received.
+func (c *CloudFormationCredentialsProvider) UnmarshalJSON(b []byte) error {
+	// the alias drops the methods of the provider so this isn't called recursively
+	type provider CloudFormationCredentialsProvider
+
+	var p provider
+	if err := json.Unmarshal(b, &p); err != nil {
+		return err
+	}
+
+	*c = CloudFormationCredentialsProvider(p)
+	c.received = time.Now()
+
+	return nil
+}
+
+// IsEmpty reports whether no credentials were supplied.
+func (c *CloudFormationCredentialsProvider) IsEmpty() bool {
+	return len(c.AccessKeyID) == 0 || len(c.SecretAccessKey) == 0
 }
 
 // Retrieve ...
+//
+// Missing and expired credentials are returned as an error with the
+// InvalidCredentials handler error code, rather than being used to sign requests.
 func (c *CloudFormationCredentialsProvider) Retrieve() (credentials.Value, error) {
 	c.retrieved = false
 
+	if c.IsEmpty() {
+		return credentials.Value{ProviderName: CloudFormationCredentialsProviderName}, cfnerr.New(cloudformation.HandlerErrorCodeInvalidCredentials, "No credentials were supplied", nil)
+	}
+
+	if c.IsExpired() {
+		return credentials.Value{ProviderName: CloudFormationCredentialsProviderName}, cfnerr.New(cloudformation.HandlerErrorCodeInvalidCredentials, "Credentials expired at "+c.ExpiresAt().Format(time.RFC3339), nil)
+	}
+
 	value := credentials.Value{
 		AccessKeyID:     c.AccessKeyID,
 		SecretAccessKey: c.SecretAccessKey,
@@ -56,20 +107,44 @@ func (c *CloudFormationCredentialsProvider) Retrieve() (credentials.Value, error
 
 // IsExpired ...
 func (c *CloudFormationCredentialsProvider) IsExpired() bool {
-	return false
+	t := c.ExpiresAt()
+	return !t.IsZero() && !time.Now().Before(t)
+}
+
+// ExpiresAt returns when the credentials expire, either as supplied by
+// CloudFormation or CredentialsTTL after they were received.
+//
+// Credentials are received by NewProvider or when decoded from JSON. A provider
+// built as a literal without an Expiration never expires, and ExpiresAt returns
+// the zero time. The SDK calls ExpiresAt from concurrent requests, so it never
+// modifies the provider.
+func (c *CloudFormationCredentialsProvider) ExpiresAt() time.Time {
+	if c.Expiration != nil {
+		return *c.Expiration
+	}
+
+	if c.received.IsZero() {
+		return time.Time{}
+	}
+
+	return c.received.Add(CredentialsTTL)
 }
 
 // SessionFromCredentialsProvider creates a new AWS SDK session from a credentials provider
 //
 // A credentials provider is an interface in the AWS SDK's credentials package (aws/credentials)
-// We transform it into a session for later use in the RPDK
-func SessionFromCredentialsProvider(provider credentials.Provider) *session.Session {
+// We transform it into a session for later use in the RPDK. Any additional configs,
+// such as Endpoints.Config, are merged in order on top of the credentials.
+func SessionFromCredentialsProvider(provider credentials.Provider, cfgs ...*aws.Config) *session.Session {
 	creds := credentials.NewCredentials(provider)
 
+	cfg := aws.Config{
+		Credentials: creds,
+	}
+	cfg.MergeIn(cfgs...)
+
 	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		Config: aws.Config{
-			Credentials: creds,
-		},
+		Config: cfg,
 	}))
 
 	return sess
@@ -1,6 +1,19 @@
 package credentials
 
-import "testing"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/cfnerr"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/smithy-go"
+)
 
 func TestCredentials(t *testing.T) {
 	t.Run("New", func(t *testing.T) {
@@ -19,11 +32,102 @@ func TestCredentials(t *testing.T) {
 		creds := NewProvider("a", "b", "c")
 
 		if creds.IsExpired() != false {
-			t.Fatalf("Credentials should never expire")
+			t.Fatalf("Fresh credentials should not be expired")
+		}
+	})
+
+	t.Run("Expiration", func(t *testing.T) {
+		past := time.Now().Add(-time.Minute)
+		creds := &CloudFormationCredentialsProvider{AccessKeyID: "a", SecretAccessKey: "b", Expiration: &past}
+
+		if !creds.IsExpired() {
+			t.Fatalf("Credentials should be expired")
+		}
+
+		_, err := creds.Retrieve()
+		if cerr, ok := err.(cfnerr.Error); !ok || cerr.Code() != "InvalidCredentials" {
+			t.Fatalf("Expected an InvalidCredentials error: %v", err)
+		}
+	})
+
+	t.Run("TTL", func(t *testing.T) {
+		creds := &CloudFormationCredentialsProvider{}
+		if err := json.Unmarshal([]byte(`{"accessKeyId": "a", "secretAccessKey": "b", "sessionToken": "c"}`), creds); err != nil {
+			t.Fatalf("Unable to unmarshal credentials: %v", err)
+		}
+
+		if creds.AccessKeyID != "a" {
+			t.Fatalf("Incorrect access key: %v", creds.AccessKeyID)
+		}
+		if d := time.Until(creds.ExpiresAt()); d <= 0 || d > CredentialsTTL {
+			t.Fatalf("Incorrect expiry: %v", creds.ExpiresAt())
+		}
+
+		c := credentials.NewCredentials(creds)
+		if _, err := c.ExpiresAt(); err != nil {
+			t.Fatalf("Expiry not exposed to the SDK: %v", err)
+		}
+	})
+
+	t.Run("Never received", func(t *testing.T) {
+		creds := &CloudFormationCredentialsProvider{AccessKeyID: "a", SecretAccessKey: "b"}
+
+		if creds.IsExpired() || !creds.ExpiresAt().IsZero() {
+			t.Fatalf("Credentials never received shouldn't expire, expiry %v", creds.ExpiresAt())
+		}
+		if _, err := creds.Retrieve(); err != nil {
+			t.Fatalf("Unable to retrieve credentials: %v", err)
+		}
+		if !creds.received.IsZero() {
+			t.Fatalf("ExpiresAt modified the provider")
+		}
+
+		v, err := ConfigFromCredentialsProvider(creds, "us-east-1", Endpoints{}).Credentials.Retrieve(context.Background())
+		if err != nil {
+			t.Fatalf("Unable to retrieve credentials: %v", err)
+		}
+		if v.CanExpire {
+			t.Fatalf("Credentials never received shouldn't expire in SDK v2")
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		creds := &CloudFormationCredentialsProvider{}
+
+		if !creds.IsEmpty() {
+			t.Fatalf("Credentials should be empty")
+		}
+
+		_, err := creds.Retrieve()
+		if cerr, ok := err.(cfnerr.Error); !ok || cerr.Code() != "InvalidCredentials" {
+			t.Fatalf("Expected an InvalidCredentials error: %v", err)
 		}
 	})
 }
 
+func TestIsInvalidCredentialsError(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"Nil", nil, false},
+		{"Plain", errors.New("ExpiredToken"), false},
+		{"ExpiredToken", awserr.New("ExpiredToken", "expired", nil), true},
+		{"UnrecognizedClientException", awserr.New("UnrecognizedClientException", "unknown", nil), true},
+		{"AccessDenied", awserr.New("AccessDenied", "denied", nil), false},
+		{"Wrapped", cfnerr.New("Foo", "foo", awserr.New("ExpiredToken", "expired", nil)), true},
+		{"Wrapped fmt", fmt.Errorf("foo: %w", awserr.New("ExpiredToken", "expired", nil)), true},
+		{"SDK v2", fmt.Errorf("foo: %w", &smithy.GenericAPIError{Code: "UnrecognizedClientException"}), true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsInvalidCredentialsError(tt.err); got != tt.want {
+				t.Errorf("IsInvalidCredentialsError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestSessionFromCredentialsProvider(t *testing.T) {
 	t.Run("Happy Path", func(t *testing.T) {
 		creds := NewProvider("a", "b", "c")
@@ -34,3 +138,158 @@ func TestSessionFromCredentialsProvider(t *testing.T) {
 		}
 	})
 }
+
+func TestEndpoints(t *testing.T) {
+	t.Run("From Env", func(t *testing.T) {
+		t.Setenv(EndpointURLEnv, "http://localhost:4566")
+		t.Setenv(ServiceEndpointURLsEnv, "logs=http://localhost:4567, monitoring = http://localhost:4568,bogus")
+
+		e := EndpointsFromEnv()
+		if e.Global != "http://localhost:4566" {
+			t.Fatalf("Incorrect global endpoint: %v", e.Global)
+		}
+		if len(e.Services) != 2 || e.Services["monitoring"] != "http://localhost:4568" {
+			t.Fatalf("Incorrect service endpoints: %v", e.Services)
+		}
+	})
+
+	t.Run("Resolve", func(t *testing.T) {
+		e := Endpoints{
+			Global:   "http://localhost:4566",
+			Services: map[string]string{"logs": "http://localhost:4567"},
+		}
+
+		r, err := e.EndpointFor("logs", "us-east-1")
+		if err != nil {
+			t.Fatalf("Unable to resolve endpoint: %v", err)
+		}
+		if r.URL != "http://localhost:4567" || r.SigningRegion != "us-east-1" {
+			t.Fatalf("Incorrect service endpoint: %v", r)
+		}
+
+		r, err = e.EndpointFor("events", "us-east-1")
+		if err != nil {
+			t.Fatalf("Unable to resolve endpoint: %v", err)
+		}
+		if r.URL != "http://localhost:4566" {
+			t.Fatalf("Incorrect global endpoint: %v", r.URL)
+		}
+	})
+
+	t.Run("Default", func(t *testing.T) {
+		e := Endpoints{}
+
+		r, err := e.EndpointFor("logs", "us-east-1")
+		if err != nil {
+			t.Fatalf("Unable to resolve endpoint: %v", err)
+		}
+		if r.URL != "https://logs.us-east-1.amazonaws.com" {
+			t.Fatalf("Incorrect default endpoint: %v", r.URL)
+		}
+		if e.Config().EndpointResolver != nil {
+			t.Fatalf("Empty endpoints should not set a resolver")
+		}
+	})
+
+	t.Run("Path style", func(t *testing.T) {
+		tests := []struct {
+			name string
+			e    Endpoints
+			want bool
+		}{
+			{"Global", Endpoints{Global: "http://localhost:4566"}, true},
+			{"S3", Endpoints{Services: map[string]string{"s3": "http://localhost:4566"}}, true},
+			{"Logs only", Endpoints{Services: map[string]string{"logs": "http://localhost:4566"}}, false},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if got := aws.BoolValue(tt.e.Config().S3ForcePathStyle); got != tt.want {
+					t.Errorf("S3ForcePathStyle = %v; want %v", got, tt.want)
+				}
+			})
+		}
+	})
+
+	t.Run("Session", func(t *testing.T) {
+		e := Endpoints{Global: "http://localhost:4566"}
+		sess := SessionFromCredentialsProvider(NewProvider("a", "b", "c"), e.Config())
+
+		r, err := sess.Config.EndpointResolver.EndpointFor("sts", "us-west-2")
+		if err != nil {
+			t.Fatalf("Unable to resolve endpoint: %v", err)
+		}
+		if r.URL != "http://localhost:4566" {
+			t.Fatalf("Session doesn't use the override: %v", r.URL)
+		}
+	})
+}
+
+func TestConfigFromCredentialsProvider(t *testing.T) {
+	t.Run("Happy Path", func(t *testing.T) {
+		cfg := ConfigFromCredentialsProvider(NewProvider("a", "b", "c"), "us-east-1", Endpoints{})
+
+		if cfg.Region != "us-east-1" {
+			t.Fatalf("Incorrect region: %v", cfg.Region)
+		}
+
+		val, err := cfg.Credentials.Retrieve(context.Background())
+		if err != nil {
+			t.Fatalf("Unable to retrieve credentials: %v", err)
+		}
+		if val.AccessKeyID != "a" || val.SecretAccessKey != "b" || val.SessionToken != "c" {
+			t.Fatalf("Incorrect credentials: %v", val)
+		}
+		if len(cfg.ConfigSources) != 0 {
+			t.Fatalf("Empty endpoints should not be a config source")
+		}
+	})
+
+	t.Run("Endpoints", func(t *testing.T) {
+		e := Endpoints{
+			Global:   "http://localhost:4566",
+			Services: map[string]string{"logs": "http://localhost:4567"},
+		}
+
+		u, ok, _ := e.GetServiceBaseEndpoint(context.Background(), "CloudWatch Logs")
+		if !ok || u != "http://localhost:4567" {
+			t.Fatalf("Incorrect service endpoint: %v", u)
+		}
+
+		u, ok, _ = e.GetServiceBaseEndpoint(context.Background(), "Secrets Manager")
+		if !ok || u != "http://localhost:4566" {
+			t.Fatalf("Incorrect global endpoint: %v", u)
+		}
+	})
+}
+
+func TestConfigFromSession(t *testing.T) {
+	t.Run("Happy Path", func(t *testing.T) {
+		e := Endpoints{Global: "http://localhost:4566"}
+		sess := SessionFromCredentialsProvider(NewProvider("a", "b", "c"), e.Config(), &aws.Config{
+			Region: aws.String("eu-west-1"),
+		})
+
+		cfg := ConfigFromSession(sess, "")
+		if cfg.Region != "eu-west-1" {
+			t.Fatalf("Incorrect region: %v", cfg.Region)
+		}
+
+		val, err := cfg.Credentials.Retrieve(context.Background())
+		if err != nil {
+			t.Fatalf("Unable to retrieve credentials: %v", err)
+		}
+		if val.AccessKeyID != "a" {
+			t.Fatalf("Incorrect access key: %v", val.AccessKeyID)
+		}
+		if len(cfg.ConfigSources) != 1 {
+			t.Fatalf("Endpoints should be carried over from the session")
+		}
+	})
+
+	t.Run("No Session", func(t *testing.T) {
+		cfg := ConfigFromSession(nil, "us-east-1")
+		if cfg.Region != "us-east-1" || cfg.Credentials != nil {
+			t.Fatalf("Unexpected config: %v", cfg)
+		}
+	})
+}
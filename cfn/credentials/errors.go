@@ -0,0 +1,48 @@
+package credentials
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/smithy-go"
+)
+
+// invalidCredentialsCodes are the service error codes returned
+// when a request is signed with expired or unknown credentials.
+var invalidCredentialsCodes = map[string]bool{
+	"ExpiredToken":                                    true,
+	"ExpiredTokenException":                           true,
+	"UnrecognizedClientException":                     true,
+	"InvalidClientTokenId":                            true,
+	cloudformation.HandlerErrorCodeInvalidCredentials: true,
+}
+
+// codedError is satisfied by both awserr.Error and cfnerr.Error.
+type codedError interface {
+	Code() string
+	OrigErr() error
+}
+
+// IsInvalidCredentialsError reports whether err, or any error it wraps,
+// was caused by expired or unrecognized credentials.
+//
+// Both AWS SDK for Go v1 and v2 errors are recognized.
+func IsInvalidCredentialsError(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && invalidCredentialsCodes[apiErr.ErrorCode()] {
+		return true
+	}
+
+	for err != nil {
+		if e, ok := err.(codedError); ok {
+			if invalidCredentialsCodes[e.Code()] {
+				return true
+			}
+			err = e.OrigErr()
+			continue
+		}
+		err = errors.Unwrap(err)
+	}
+
+	return false
+}
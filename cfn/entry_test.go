@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -114,6 +115,17 @@ func TestValidateEvent(t *testing.T) {
 	})
 }
 
+func TestCorrelationID(t *testing.T) {
+	evt := &event{BearerToken: "123456"}
+
+	if got, want := evt.correlationID(2), "8d969eef6ecad3c2-2"; got != want {
+		t.Errorf("correlationID() = %q; want %q", got, want)
+	}
+	if strings.Contains(evt.requestToken(), evt.BearerToken) {
+		t.Errorf("requestToken() = %q; the bearer token mustn't be shown", evt.requestToken())
+	}
+}
+
 func TestHandler(t *testing.T) {
 	// no-op
 }
@@ -1,7 +1,10 @@
 package cfn
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/cfnerr"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/credentials"
@@ -65,3 +68,18 @@ type resourceHandlerRequest struct {
 	NextToken                 string          `json:"nextToken"`
 	Region                    string          `json:"region"`
 }
+
+// requestToken identifies the operation in logs, metrics, log stream names and failure
+// messages. The request doesn't carry the client request token, and the bearer token
+// authorizes progress reports to CloudFormation, so only a hash of the bearer token is
+// ever shown.
+func (e *event) requestToken() string {
+	sum := sha256.Sum256([]byte(e.BearerToken))
+	return hex.EncodeToString(sum[:8])
+}
+
+// correlationID identifies an invocation from the request token and the attempt
+// number within the operation.
+func (e *event) correlationID(attempt int) string {
+	return fmt.Sprintf("%s-%d", e.requestToken(), attempt)
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/cfnerr"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/credentials"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 )
 
@@ -54,9 +55,17 @@ func NewProgressEvent() ProgressEvent {
 
 // NewFailedEvent creates a generic failure progress event
 // based on the error passed in.
+//
+// Errors caused by expired or unrecognized credentials are
+// reported with the InvalidCredentials error code.
 func NewFailedEvent(err error) ProgressEvent {
+	code := cloudformation.HandlerErrorCodeGeneralServiceException
+	if credentials.IsInvalidCredentialsError(err) {
+		code = cloudformation.HandlerErrorCodeInvalidCredentials
+	}
+
 	cerr := cfnerr.New(
-		cloudformation.HandlerErrorCodeGeneralServiceException,
+		code,
 		"Unable to complete request: "+err.Error(),
 		err,
 	)
@@ -64,6 +73,6 @@ func NewFailedEvent(err error) ProgressEvent {
 	return ProgressEvent{
 		OperationStatus:  Failed,
 		Message:          cerr.Message(),
-		HandlerErrorCode: cloudformation.HandlerErrorCodeGeneralServiceException,
+		HandlerErrorCode: code,
 	}
 }
@@ -1,8 +1,10 @@
 package handler
 
 import (
+	"errors"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/google/go-cmp/cmp"
 
@@ -71,3 +73,26 @@ func TestProgressEventMarshalJSON(t *testing.T) {
 	}
 
 }
+
+func TestNewFailedEvent(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"generic", errors.New("boom"), cloudformation.HandlerErrorCodeGeneralServiceException},
+		{"expired token", awserr.New("ExpiredToken", "The security token included in the request is expired", nil), cloudformation.HandlerErrorCodeInvalidCredentials},
+		{"unrecognized client", awserr.New("UnrecognizedClientException", "The security token included in the request is invalid", nil), cloudformation.HandlerErrorCodeInvalidCredentials},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewFailedEvent(tt.err)
+
+			if e.OperationStatus != Failed {
+				t.Errorf("Incorrect status: %v", e.OperationStatus)
+			}
+			if e.HandlerErrorCode != tt.want {
+				t.Errorf("Incorrect error code: %v, want %v", e.HandlerErrorCode, tt.want)
+			}
+		})
+	}
+}
@@ -1,10 +1,20 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/audit"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/callback"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/cfnerr"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/credentials"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/encoding"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/metrics"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/tracing"
 )
 
 const (
@@ -34,6 +44,12 @@ type Request struct {
 	// An authenticated AWS session that can be used with the AWS Go SDK
 	Session *session.Session
 
+	ctx      context.Context
+	roles    *credentials.AssumeRoleCache
+	logger   *slog.Logger
+	metrics  *metrics.Recorder
+	progress callback.Reporter
+
 	previousResourcePropertiesBody []byte
 	resourcePropertiesBody         []byte
 	typeConfigurationBody          []byte
@@ -71,7 +87,112 @@ func NewRequest(id string, ctx map[string]interface{}, requestCTX RequestContext
 		resourcePropertiesBody:         body,
 		RequestContext:                 requestCTX,
 		typeConfigurationBody:          typeConfig,
+		roles:                          credentials.NewAssumeRoleCache(credentials.RoleSessionName(requestCTX.StackID, id)),
+		logger:                         slog.Default(),
+		metrics:                        metrics.Default(),
+	}
+}
+
+// Context returns the context of the invocation
+//
+// When tracing is on, it carries the span of the invocation; AWS SDK calls
+// made with it, with clients created from AWSConfig or with the WithContext
+// methods of clients created from Session, become child spans.
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
 	}
+
+	return r.ctx
+}
+
+// WithContext returns a copy of the request with its context changed to ctx
+func (r Request) WithContext(ctx context.Context) Request {
+	r.ctx = ctx
+	return r
+}
+
+// WithProgressReporter returns a copy of the request reporting progress with c
+//
+// In tests, a callback.MemoryReporter records the progress a handler reports.
+func (r Request) WithProgressReporter(c callback.Reporter) Request {
+	r.progress = c
+	return r
+}
+
+// ReportProgress updates the status message, and the model, of a CREATE, UPDATE
+// or DELETE operation still in progress, for example during a long stabilization
+//
+// Reports are rate limited: one made too soon after the previous one is dropped
+// and callback.ErrRateLimited returned, which handlers can ignore. Outside of an
+// invocation, for example in unit tests, and for READ and LIST, progress is only logged.
+func (r *Request) ReportProgress(message string, model interface{}) error {
+	if r.progress == nil {
+		r.Logger().Debug("Progress", "message", message)
+		return nil
+	}
+
+	var b []byte
+	if model != nil {
+		m, err := encoding.Stringify(model)
+		if err != nil {
+			return cfnerr.New(marshalingError, "Unable to convert type", err)
+		}
+		if b, err = json.Marshal(m); err != nil {
+			return cfnerr.New(marshalingError, "Unable to convert type", err)
+		}
+	}
+
+	return r.progress.ReportProgress(message, b)
+}
+
+// Logger returns the structured logger of the invocation
+//
+// Records are written as JSON to the provider log group and carry the action,
+// resource type, logical ID, stack ID, client request token and callback attempt.
+func (r *Request) Logger() *slog.Logger {
+	if r.logger == nil {
+		return slog.Default()
+	}
+
+	return r.logger
+}
+
+// Metrics returns the recorder of custom metrics for the invocation
+//
+// Counters, gauges and timings are published to the namespace of the resource type
+// with the Action and ResourceType dimensions, together with the runtime's metrics.
+// Outside of an invocation, for example in unit tests, metrics are discarded.
+func (r *Request) Metrics() *metrics.Recorder {
+	return r.metrics
+}
+
+// AWSConfig returns an AWS SDK for Go v2 config for the region of the request
+//
+// The config uses the same credentials and endpoints as Session, so clients
+// created from either act on behalf of the caller. Calls made with the request
+// Context are audited, and traced when tracing is on.
+func (r *Request) AWSConfig() aws.Config {
+	cfg := credentials.ConfigFromSession(r.Session, r.RequestContext.Region)
+	tracing.AppendMiddlewares(&cfg.APIOptions)
+	audit.AppendMiddlewares(&cfg.APIOptions)
+
+	return cfg
+}
+
+// AssumeRoleSession returns a session for a role assumed with the caller's
+// credentials, for example to manage resources in another account or region
+//
+// Sessions are cached for the rest of the invocation and use a role session name
+// derived from the stack and logical ID, so calls can be attributed in CloudTrail.
+// Failures are returned with an AccessDenied or InvalidCredentials error code.
+func (r *Request) AssumeRoleSession(roleArn string, externalID string, region string) (*session.Session, error) {
+	roles := r.roles
+	if roles == nil {
+		roles = credentials.NewAssumeRoleCache(credentials.RoleSessionName(r.RequestContext.StackID, r.LogicalResourceID))
+	}
+
+	return roles.AssumeRoleSession(r.Session, roleArn, externalID, region)
 }
 
 // UnmarshalPrevious populates the provided interface
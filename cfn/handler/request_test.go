@@ -1,8 +1,14 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"testing"
 
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/callback"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/credentials"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/metrics"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/google/go-cmp/cmp"
 )
@@ -51,7 +57,7 @@ func TestUnmarshal(t *testing.T) {
 		t.Error(err)
 	}
 	if diff := cmp.Diff(actual, expectedPrevious); diff != "" {
-		t.Errorf(diff)
+		t.Error(diff)
 	}
 
 	// Current body
@@ -60,6 +66,101 @@ func TestUnmarshal(t *testing.T) {
 		t.Error(err)
 	}
 	if diff := cmp.Diff(actual, expectedCurrent); diff != "" {
-		t.Errorf(diff)
+		t.Error(diff)
+	}
+}
+
+func TestAWSConfig(t *testing.T) {
+	sess := credentials.SessionFromCredentialsProvider(credentials.NewProvider("a", "b", "c"))
+	req := NewRequest("foo", nil, RequestContext{Region: "us-west-2"}, sess, nil, nil, nil)
+
+	cfg := req.AWSConfig()
+	if cfg.Region != "us-west-2" {
+		t.Fatalf("Incorrect region: %v", cfg.Region)
+	}
+
+	val, err := cfg.Credentials.Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf("Unable to retrieve credentials: %v", err)
+	}
+	if val.AccessKeyID != "a" {
+		t.Fatalf("Incorrect access key: %v", val.AccessKeyID)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	req := NewRequest("foo", nil, RequestContext{}, nil, nil, nil, nil)
+	if req.Metrics() != nil {
+		t.Errorf("Expected no recorder outside of an invocation")
+	}
+
+	// Recording outside of an invocation is a no-op
+	req.Metrics().Count("StabilizationPolls", 1)
+
+	r := metrics.NewV2(nil, "foo::bar::test").Recorder("CREATE")
+	metrics.SetDefault(r)
+	defer metrics.SetDefault(nil)
+
+	req = NewRequest("foo", nil, RequestContext{}, nil, nil, nil, nil)
+	if req.Metrics() != r {
+		t.Errorf("Expected the recorder of the invocation")
+	}
+}
+
+func TestContext(t *testing.T) {
+	req := NewRequest("foo", nil, RequestContext{}, nil, nil, nil, nil)
+	if req.Context() != context.Background() {
+		t.Errorf("Expected the background context by default")
+	}
+
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "bar")
+	withCtx := req.WithContext(ctx)
+	if withCtx.Context() != ctx || req.Context() == ctx {
+		t.Errorf("WithContext should return a copy with the context changed")
+	}
+}
+
+// progressClient records the progress reported to CloudFormation.
+type progressClient struct {
+	inputs []*cloudformation.RecordHandlerProgressInput
+}
+
+func (c *progressClient) RecordHandlerProgress(ctx context.Context, in *cloudformation.RecordHandlerProgressInput, optFns ...func(*cloudformation.Options)) (*cloudformation.RecordHandlerProgressOutput, error) {
+	c.inputs = append(c.inputs, in)
+	return &cloudformation.RecordHandlerProgressOutput{}, nil
+}
+
+func TestReportProgress(t *testing.T) {
+	type Model struct {
+		Name  *string
+		Count *int
+	}
+	name, count := "my-bucket", 2
+
+	// outside of an invocation progress is only logged
+	req := NewRequest("foo", nil, RequestContext{}, nil, nil, nil, nil)
+	if err := req.ReportProgress("Waiting", &Model{Name: &name}); err != nil {
+		t.Fatalf("ReportProgress() = %v", err)
+	}
+
+	client := &progressClient{}
+	req = req.WithProgressReporter(callback.NewV2(client, "123456"))
+	if err := req.ReportProgress("Waiting for the bucket", &Model{Name: &name, Count: &count}); err != nil {
+		t.Fatalf("ReportProgress() = %v", err)
+	}
+	if err := req.ReportProgress("Still waiting", nil); !errors.Is(err, callback.ErrRateLimited) {
+		t.Errorf("ReportProgress() = %v; want ErrRateLimited", err)
+	}
+
+	if len(client.inputs) != 1 {
+		t.Fatalf("RecordHandlerProgress calls = %d; want 1", len(client.inputs))
+	}
+	in := client.inputs[0]
+	if *in.BearerToken != "123456" || *in.StatusMessage != "Waiting for the bucket" {
+		t.Errorf("RecordHandlerProgress input = %+v", in)
+	}
+	if diff := cmp.Diff(`{"Name":"my-bucket","Count":"2"}`, *in.ResourceModel); diff != "" {
+		t.Error(diff)
 	}
 }
@@ -1,28 +1,54 @@
 package logging
 
 import (
+	"context"
+	"errors"
 	"io"
 	"log"
-	"os"
+	"sync"
 	"time"
+	"unicode/utf8"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/aws/smithy-go"
 
 	"github.com/segmentio/ksuid"
 )
 
-// NewCloudWatchLogsProvider creates a io.Writer that writes
+// CloudWatchLogsAPI is the subset of the CloudWatch Logs API used to
+// ship provider logs.
+//
+// It is satisfied by the AWS SDK for Go v2 client, *cloudwatchlogs.Client.
+type CloudWatchLogsAPI interface {
+	DescribeLogGroups(ctx context.Context, params *cloudwatchlogs.DescribeLogGroupsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DescribeLogGroupsOutput, error)
+	CreateLogGroup(ctx context.Context, params *cloudwatchlogs.CreateLogGroupInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogGroupOutput, error)
+	CreateLogStream(ctx context.Context, params *cloudwatchlogs.CreateLogStreamInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogStreamOutput, error)
+	PutLogEvents(ctx context.Context, params *cloudwatchlogs.PutLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error)
+	PutRetentionPolicy(ctx context.Context, params *cloudwatchlogs.PutRetentionPolicyInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutRetentionPolicyOutput, error)
+	AssociateKmsKey(ctx context.Context, params *cloudwatchlogs.AssociateKmsKeyInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.AssociateKmsKeyOutput, error)
+}
+
+// NewCloudWatchLogsProvider creates a io.Writer that writes to a specifc
+// log group with a client of the AWS SDK for Go v1.
+//
+// Deprecated: use NewCloudWatchLogsProviderV2 with a client of the AWS SDK for Go v2.
+func NewCloudWatchLogsProvider(client cloudwatchlogsiface.CloudWatchLogsAPI, logGroupName string) (io.Writer, error) {
+	return NewCloudWatchLogsProviderV2(cloudWatchLogsV1{client: client}, logGroupName)
+}
+
+// NewCloudWatchLogsProviderV2 creates a io.Writer that writes
 // to a specifc log group.
 //
-// Each time NewCloudWatchLogsProvider is used, a new log stream is created
+// Each time NewCloudWatchLogsProviderV2 is used, a new log stream is created
 // inside the log group. The log stream will have a unique, random identifer
 //
-//	sess := session.Must(aws.NewConfig())
-//	svc := cloudwatchlogs.New(sess)
+//	cfg := req.AWSConfig()
+//	svc := cloudwatchlogs.NewFromConfig(cfg)
 //
-//	provider, err := NewCloudWatchLogsProvider(svc, "pineapple-pizza")
+//	provider, err := NewCloudWatchLogsProviderV2(svc, "pineapple-pizza")
 //	if err != nil {
 //		panic(err)
 //	}
@@ -31,29 +57,35 @@ import (
 //	// pushed through the Write func and sent to CloudWatch Logs
 //	log.SetOutput(provider)
 //	log.Printf("Eric loves pineapple pizza!")
-func NewCloudWatchLogsProvider(client cloudwatchlogsiface.CloudWatchLogsAPI, logGroupName string) (io.Writer, error) {
-	logger := New("internal: ")
+func NewCloudWatchLogsProviderV2(client CloudWatchLogsAPI, logGroupName string) (io.Writer, error) {
+	return newCloudWatchLogsProvider(client, logGroupName, "", LogGroupOptions{})
+}
 
-	// If we're running in SAM CLI, we can return the stdout
-	if len(os.Getenv("AWS_SAM_LOCAL")) > 0 && len(os.Getenv("AWS_FORCE_INTEGRATIONS")) == 0 {
-		return stdErr, nil
-	}
+// newCloudWatchLogsProvider creates a provider writing to logStreamName, creating
+// the log group with opts if it doesn't exist. A random stream name is used when
+// logStreamName is empty.
+func newCloudWatchLogsProvider(client CloudWatchLogsAPI, logGroupName string, logStreamName string, opts LogGroupOptions) (*cloudWatchLogsProvider, error) {
+	// the internal logger must never write to the provider log output,
+	// or the provider would end up writing to itself
+	logger := log.New(stdErr, "internal: ", log.LstdFlags)
 
-	ok, err := CloudWatchLogGroupExists(client, logGroupName)
+	ok, err := CloudWatchLogGroupExistsV2(client, logGroupName)
 	if err != nil {
 		return nil, err
 	}
 
 	if !ok {
 		logger.Printf("Need to create loggroup: %v", logGroupName)
-		if err := CreateNewCloudWatchLogGroup(client, logGroupName); err != nil {
+		if err := CreateNewCloudWatchLogGroupV2(client, logGroupName, opts); err != nil {
 			return nil, err
 		}
 	}
 
-	logStreamName := ksuid.New()
+	if len(logStreamName) == 0 {
+		logStreamName = ksuid.New().String()
+	}
 	// need to create logstream
-	if err := CreateNewLogStream(client, logGroupName, logStreamName.String()); err != nil {
+	if err := CreateNewLogStreamV2(client, logGroupName, logStreamName); err != nil {
 		return nil, err
 	}
 
@@ -61,78 +93,275 @@ func NewCloudWatchLogsProvider(client cloudwatchlogsiface.CloudWatchLogsAPI, log
 		client: client,
 
 		logGroupName:  logGroupName,
-		logStreamName: logStreamName.String(),
+		logStreamName: logStreamName,
 
 		logger: logger,
 	}
 
+	// the first batch is sent right away so a missing permission shows up here
 	if _, err := provider.Write([]byte("Initialization of log stream")); err != nil {
 		return nil, err
 	}
+	if err := provider.Flush(); err != nil {
+		return nil, err
+	}
 
 	return provider, nil
 }
 
+const (
+	// maxBatchEvents is the maximum number of events in a PutLogEvents call.
+	maxBatchEvents = 10000
+	// maxBatchBytes is the maximum size of a PutLogEvents call.
+	maxBatchBytes = 1048576
+	// eventOverheadBytes is added to the size of each event's message.
+	eventOverheadBytes = 26
+	// maxEventBytes is the maximum size of an event's message; longer messages are split.
+	maxEventBytes = 256*1024 - eventOverheadBytes
+	// maxBatchSpan is the maximum time between the first and last event of a batch.
+	maxBatchSpan = 24 * time.Hour
+	// maxPutAttempts is the number of attempts made to send a batch.
+	maxPutAttempts = 5
+)
+
+// FlushInterval is the longest a log line is buffered before it's sent.
+var FlushInterval = time.Second
+
+// Flusher is implemented by writers that buffer log lines.
+type Flusher interface {
+	// Flush sends all buffered log lines.
+	Flush() error
+}
+
+// cloudWatchLogsProvider buffers log lines and sends them to a log stream in batches.
+//
+// A batch is sent when it reaches the PutLogEvents limits, FlushInterval after its
+// first line was written, or when Flush is called.
 type cloudWatchLogsProvider struct {
-	client cloudwatchlogsiface.CloudWatchLogsAPI
+	// sendMu guards the client and sequence token. It's separate from mu so
+	// writers aren't blocked while a throttled batch backs off.
+	sendMu sync.Mutex
+
+	client CloudWatchLogsAPI
 
 	logGroupName  string
 	logStreamName string
 
 	sequence string
 
+	mu            sync.Mutex
+	events        []types.InputLogEvent
+	size          int
+	lastTimestamp int64
+	timer         *time.Timer
+
 	logger *log.Logger
 }
 
+// Write buffers b as one or more log events.
+//
+// The error of any batch sent to make room for b is returned, but b is always buffered.
 func (p *cloudWatchLogsProvider) Write(b []byte) (int, error) {
-	p.logger.Printf("Need to write: %v", string(b))
+	p.mu.Lock()
+
+	// events in a batch must be in chronological order
+	ts := time.Now().UnixMilli()
+	if ts < p.lastTimestamp {
+		ts = p.lastTimestamp
+	}
+	p.lastTimestamp = ts
+
+	var batches [][]types.InputLogEvent
+	for _, msg := range splitMessage(string(b), maxEventBytes) {
+		if p.isFull(len(msg), ts) {
+			batches = append(batches, p.take())
+		}
+
+		p.events = append(p.events, types.InputLogEvent{
+			Message:   aws.String(msg),
+			Timestamp: aws.Int64(ts),
+		})
+		p.size += len(msg) + eventOverheadBytes
+	}
+
+	if len(p.events) != 0 && p.timer == nil {
+		p.timer = time.AfterFunc(FlushInterval, func() {
+			if err := p.Flush(); err != nil {
+				p.logger.Printf("Unable to send provider logs: %v", err)
+			}
+		})
+	}
+
+	p.mu.Unlock()
+
+	var ferr error
+	for _, events := range batches {
+		if err := p.send(events); err != nil {
+			ferr = err
+		}
+	}
+
+	return len(b), ferr
+}
+
+// Flush sends all buffered log events.
+func (p *cloudWatchLogsProvider) Flush() error {
+	p.mu.Lock()
+	events := p.take()
+	p.mu.Unlock()
+
+	return p.send(events)
+}
+
+// setClient replaces the client used to send the following batches.
+func (p *cloudWatchLogsProvider) setClient(client CloudWatchLogsAPI) {
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+
+	p.client = client
+}
+
+// isFull reports whether an event of the given size and timestamp would
+// take the buffered batch over the PutLogEvents limits.
+func (p *cloudWatchLogsProvider) isFull(size int, ts int64) bool {
+	if len(p.events) == 0 {
+		return false
+	}
+
+	return len(p.events) >= maxBatchEvents ||
+		p.size+size+eventOverheadBytes > maxBatchBytes ||
+		time.Duration(ts-aws.ToInt64(p.events[0].Timestamp))*time.Millisecond > maxBatchSpan
+}
+
+// take removes the buffered batch and stops its flush timer. p.mu must be held.
+//
+// The batch is dropped whether or not it can be sent,
+// so a failing destination can't grow the buffer forever.
+func (p *cloudWatchLogsProvider) take() []types.InputLogEvent {
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
 
+	events := p.events
+	p.events = nil
+	p.size = 0
+
+	return events
+}
+
+// send sends a batch taken from the buffer. Batches are sent one at a time.
+func (p *cloudWatchLogsProvider) send(events []types.InputLogEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+
+	return p.putLogEvents(events)
+}
+
+// putLogEvents sends a batch, recovering the sequence token and retrying throttled calls.
+// p.sendMu must be held.
+func (p *cloudWatchLogsProvider) putLogEvents(events []types.InputLogEvent) error {
 	input := &cloudwatchlogs.PutLogEventsInput{
 		LogGroupName:  aws.String(p.logGroupName),
 		LogStreamName: aws.String(p.logStreamName),
 
-		LogEvents: []*cloudwatchlogs.InputLogEvent{
-			{
-				Message:   aws.String(string(b)),
-				Timestamp: aws.Int64(time.Now().UnixNano() / int64(time.Millisecond)),
-			},
-		},
+		LogEvents: events,
 	}
 
-	if len(p.sequence) != 0 {
-		input.SetSequenceToken(p.sequence)
+	var err error
+	for attempt := 0; attempt < maxPutAttempts; attempt++ {
+		input.SequenceToken = nil
+		if len(p.sequence) != 0 {
+			input.SequenceToken = aws.String(p.sequence)
+		}
+
+		var resp *cloudwatchlogs.PutLogEventsOutput
+		resp, err = p.client.PutLogEvents(context.Background(), input)
+		if err == nil {
+			p.sequence = aws.ToString(resp.NextSequenceToken)
+			return nil
+		}
+
+		var invalidSequence *types.InvalidSequenceTokenException
+		var alreadyAccepted *types.DataAlreadyAcceptedException
+		switch {
+		case errors.As(err, &alreadyAccepted):
+			// the batch was sent by a previous attempt
+			p.sequence = aws.ToString(alreadyAccepted.ExpectedSequenceToken)
+			return nil
+		case errors.As(err, &invalidSequence):
+			p.sequence = aws.ToString(invalidSequence.ExpectedSequenceToken)
+		case isThrottlingError(err):
+			time.Sleep(time.Duration(1<<attempt) * 100 * time.Millisecond)
+		default:
+			return err
+		}
 	}
 
-	resp, err := p.client.PutLogEvents(input)
+	return err
+}
 
-	if err != nil {
-		return 0, err
+// isThrottlingError reports whether a PutLogEvents call should be retried after a delay.
+func isThrottlingError(err error) bool {
+	var unavailable *types.ServiceUnavailableException
+	if errors.As(err, &unavailable) {
+		return true
+	}
+
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "ThrottlingException"
+}
+
+// splitMessage splits s into messages of at most n bytes without splitting UTF-8 characters.
+func splitMessage(s string, n int) []string {
+	var msgs []string
+	for len(s) > n {
+		i := n
+		for i > 0 && !utf8.RuneStart(s[i]) {
+			i--
+		}
+		msgs = append(msgs, s[:i])
+		s = s[i:]
 	}
 
-	p.sequence = *resp.NextSequenceToken
+	if len(s) != 0 {
+		msgs = append(msgs, s)
+	}
 
-	return len(b), nil
+	return msgs
 }
 
-// CloudWatchLogGroupExists checks if a log group exists
+// CloudWatchLogGroupExists checks if a log group exists with a client
+// of the AWS SDK for Go v1.
+//
+// Deprecated: use CloudWatchLogGroupExistsV2 with a client of the AWS SDK for Go v2.
+func CloudWatchLogGroupExists(client cloudwatchlogsiface.CloudWatchLogsAPI, logGroupName string) (bool, error) {
+	return CloudWatchLogGroupExistsV2(cloudWatchLogsV1{client: client}, logGroupName)
+}
+
+// CloudWatchLogGroupExistsV2 checks if a log group exists
 //
 // Using the client provided, it will check the CloudWatch Logs
 // service to verify the log group
 //
-//	sess := session.Must(aws.NewConfig())
-//	svc := cloudwatchlogs.New(sess)
+//	cfg := req.AWSConfig()
+//	svc := cloudwatchlogs.NewFromConfig(cfg)
 //
 //	// checks if the pineapple-pizza log group exists
-//	ok, err := LogGroupExists(svc, "pineapple-pizza")
+//	ok, err := CloudWatchLogGroupExistsV2(svc, "pineapple-pizza")
 //	if err != nil {
 //		panic(err)
 //	}
 //	if ok {
 //		// do something
 //	}
-func CloudWatchLogGroupExists(client cloudwatchlogsiface.CloudWatchLogsAPI, logGroupName string) (bool, error) {
-	resp, err := client.DescribeLogGroups(&cloudwatchlogs.DescribeLogGroupsInput{
-		Limit:              aws.Int64(1),
+func CloudWatchLogGroupExistsV2(client CloudWatchLogsAPI, logGroupName string) (bool, error) {
+	resp, err := client.DescribeLogGroups(context.Background(), &cloudwatchlogs.DescribeLogGroupsInput{
+		Limit:              aws.Int32(1),
 		LogGroupNamePrefix: aws.String(logGroupName),
 	})
 
@@ -140,40 +369,99 @@ func CloudWatchLogGroupExists(client cloudwatchlogsiface.CloudWatchLogsAPI, logG
 		return false, err
 	}
 
-	if len(resp.LogGroups) == 0 || *resp.LogGroups[0].LogGroupName != logGroupName {
+	if len(resp.LogGroups) == 0 || aws.ToString(resp.LogGroups[0].LogGroupName) != logGroupName {
 		return false, nil
 	}
 
 	return true, nil
 }
 
-// CreateNewCloudWatchLogGroup creates a log group in CloudWatch Logs.
+// CreateNewCloudWatchLogGroup creates a log group in CloudWatch Logs with
+// a client of the AWS SDK for Go v1.
+//
+// Deprecated: use CreateNewCloudWatchLogGroupV2 with a client of the AWS SDK for Go v2.
+func CreateNewCloudWatchLogGroup(client cloudwatchlogsiface.CloudWatchLogsAPI, logGroupName string) error {
+	return CreateNewCloudWatchLogGroupV2(cloudWatchLogsV1{client: client}, logGroupName)
+}
+
+// CreateNewCloudWatchLogGroupV2 creates a log group in CloudWatch Logs.
 //
 // Using a passed in client to create the call to the service, it
-// will create a log group of the specified name
+// will create a log group of the specified name. Optional LogGroupOptions
+// set the retention and KMS key of the log group; they're also applied
+// when the log group already exists.
 //
-//	sess := session.Must(aws.NewConfig())
-//	svc := cloudwatchlogs.New(sess)
+//	cfg := req.AWSConfig()
+//	svc := cloudwatchlogs.NewFromConfig(cfg)
 //
-//	if err := CreateNewCloudWatchLogGroup(svc, "pineapple-pizza"); err != nil {
+//	if err := CreateNewCloudWatchLogGroupV2(svc, "pineapple-pizza", LogGroupOptions{RetentionInDays: 14}); err != nil {
 //		panic("Unable to create log group", err)
 //	}
-func CreateNewCloudWatchLogGroup(client cloudwatchlogsiface.CloudWatchLogsAPI, logGroupName string) error {
-	if _, err := client.CreateLogGroup(&cloudwatchlogs.CreateLogGroupInput{
+func CreateNewCloudWatchLogGroupV2(client CloudWatchLogsAPI, logGroupName string, opts ...LogGroupOptions) error {
+	var o LogGroupOptions
+	if len(opts) != 0 {
+		o = opts[0]
+	}
+
+	input := &cloudwatchlogs.CreateLogGroupInput{
 		LogGroupName: aws.String(logGroupName),
-	}); err != nil {
-		return err
+	}
+	if len(o.KMSKeyID) != 0 {
+		input.KmsKeyId = aws.String(o.KMSKeyID)
+	}
+
+	if _, err := client.CreateLogGroup(context.Background(), input); err != nil {
+		// another invocation created the group since it was looked up, so
+		// the options still have to be applied to it
+		var exists *types.ResourceAlreadyExistsException
+		if !errors.As(err, &exists) {
+			return err
+		}
+
+		if len(o.KMSKeyID) != 0 {
+			if _, err := client.AssociateKmsKey(context.Background(), &cloudwatchlogs.AssociateKmsKeyInput{
+				LogGroupName: aws.String(logGroupName),
+				KmsKeyId:     aws.String(o.KMSKeyID),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if o.RetentionInDays > 0 {
+		if _, err := client.PutRetentionPolicy(context.Background(), &cloudwatchlogs.PutRetentionPolicyInput{
+			LogGroupName:    aws.String(logGroupName),
+			RetentionInDays: aws.Int32(o.RetentionInDays),
+		}); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-// CreateNewLogStream creates a log stream inside of a LogGroup
+// CreateNewLogStream creates a log stream inside of a LogGroup with a
+// client of the AWS SDK for Go v1.
+//
+// Deprecated: use CreateNewLogStreamV2 with a client of the AWS SDK for Go v2.
 func CreateNewLogStream(client cloudwatchlogsiface.CloudWatchLogsAPI, logGroupName string, logStreamName string) error {
-	_, err := client.CreateLogStream(&cloudwatchlogs.CreateLogStreamInput{
+	return CreateNewLogStreamV2(cloudWatchLogsV1{client: client}, logGroupName, logStreamName)
+}
+
+// CreateNewLogStreamV2 creates a log stream inside of a LogGroup
+//
+// A log stream that already exists isn't an error, so streams with
+// predictable names can be written to by several invocations.
+func CreateNewLogStreamV2(client CloudWatchLogsAPI, logGroupName string, logStreamName string) error {
+	_, err := client.CreateLogStream(context.Background(), &cloudwatchlogs.CreateLogStreamInput{
 		LogGroupName:  aws.String(logGroupName),
 		LogStreamName: aws.String(logStreamName),
 	})
 
+	var exists *types.ResourceAlreadyExistsException
+	if errors.As(err, &exists) {
+		return nil
+	}
+
 	return err
 }
@@ -1,12 +1,19 @@
 package logging
 
 import (
+	"context"
+	"sync/atomic"
 	"testing"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	awsv1 "github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	cloudwatchlogsv1 "github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/aws/smithy-go"
 )
 
 func TestCloudWatchLogProvider(t *testing.T) {
@@ -14,7 +21,7 @@ func TestCloudWatchLogProvider(t *testing.T) {
 		client := CallbackCloudWatchLogs{
 			DescribeLogGroupsFn: func(input *cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
 				return &cloudwatchlogs.DescribeLogGroupsOutput{
-					LogGroups: []*cloudwatchlogs.LogGroup{
+					LogGroups: []types.LogGroup{
 						{LogGroupName: input.LogGroupNamePrefix},
 					},
 				}, nil
@@ -35,7 +42,7 @@ func TestCloudWatchLogProvider(t *testing.T) {
 			},
 		}
 
-		_, err := NewCloudWatchLogsProvider(client, "pineapple-pizza")
+		_, err := NewCloudWatchLogsProviderV2(client, "pineapple-pizza")
 		if err != nil {
 			t.Fatalf("Error returned: %v", err)
 		}
@@ -44,7 +51,7 @@ func TestCloudWatchLogProvider(t *testing.T) {
 	t.Run("Init Error Exists", func(t *testing.T) {
 		client := CallbackCloudWatchLogs{
 			DescribeLogGroupsFn: func(input *cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
-				return nil, awserr.New("Invalid", "Invalid", nil)
+				return nil, &smithy.GenericAPIError{Code: "Invalid", Message: "Invalid"}
 			},
 
 			CreateLogGroupFn: func(input *cloudwatchlogs.CreateLogGroupInput) (*cloudwatchlogs.CreateLogGroupOutput, error) {
@@ -62,7 +69,7 @@ func TestCloudWatchLogProvider(t *testing.T) {
 			},
 		}
 
-		_, err := NewCloudWatchLogsProvider(client, "pineapple-pizza")
+		_, err := NewCloudWatchLogsProviderV2(client, "pineapple-pizza")
 		if err == nil {
 			t.Fatalf("Error returned: %v", err)
 		}
@@ -72,12 +79,12 @@ func TestCloudWatchLogProvider(t *testing.T) {
 		client := CallbackCloudWatchLogs{
 			DescribeLogGroupsFn: func(input *cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
 				return &cloudwatchlogs.DescribeLogGroupsOutput{
-					LogGroups: []*cloudwatchlogs.LogGroup{},
+					LogGroups: []types.LogGroup{},
 				}, nil
 			},
 
 			CreateLogGroupFn: func(input *cloudwatchlogs.CreateLogGroupInput) (*cloudwatchlogs.CreateLogGroupOutput, error) {
-				return nil, awserr.New("Invalid", "Invalid", nil)
+				return nil, &smithy.GenericAPIError{Code: "Invalid", Message: "Invalid"}
 			},
 
 			CreateLogStreamFn: func(input *cloudwatchlogs.CreateLogStreamInput) (*cloudwatchlogs.CreateLogStreamOutput, error) {
@@ -91,7 +98,7 @@ func TestCloudWatchLogProvider(t *testing.T) {
 			},
 		}
 
-		_, err := NewCloudWatchLogsProvider(client, "pineapple-pizza")
+		_, err := NewCloudWatchLogsProviderV2(client, "pineapple-pizza")
 		if err == nil {
 			t.Fatalf("Error returned: %v", err)
 		}
@@ -101,7 +108,7 @@ func TestCloudWatchLogProvider(t *testing.T) {
 		client := CallbackCloudWatchLogs{
 			DescribeLogGroupsFn: func(input *cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
 				return &cloudwatchlogs.DescribeLogGroupsOutput{
-					LogGroups: []*cloudwatchlogs.LogGroup{
+					LogGroups: []types.LogGroup{
 						{LogGroupName: input.LogGroupNamePrefix},
 					},
 				}, nil
@@ -122,7 +129,7 @@ func TestCloudWatchLogProvider(t *testing.T) {
 			},
 		}
 
-		p, err := NewCloudWatchLogsProvider(client, "pineapple-pizza")
+		p, err := NewCloudWatchLogsProviderV2(client, "pineapple-pizza")
 		if err != nil {
 			t.Fatalf("Error returned: %v", err)
 		}
@@ -143,7 +150,7 @@ func TestCloudWatchLogProvider(t *testing.T) {
 		client := CallbackCloudWatchLogs{
 			DescribeLogGroupsFn: func(input *cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
 				return &cloudwatchlogs.DescribeLogGroupsOutput{
-					LogGroups: []*cloudwatchlogs.LogGroup{
+					LogGroups: []types.LogGroup{
 						{LogGroupName: input.LogGroupNamePrefix},
 					},
 				}, nil
@@ -165,36 +172,258 @@ func TestCloudWatchLogProvider(t *testing.T) {
 					}, nil
 				}
 
-				return nil, awserr.New("Invalid", "Invalid", nil)
+				return nil, &smithy.GenericAPIError{Code: "Invalid", Message: "Invalid"}
 			},
 		}
 
-		p, err := NewCloudWatchLogsProvider(client, "pineapple-pizza")
+		p, err := NewCloudWatchLogsProviderV2(client, "pineapple-pizza")
 		if err != nil {
 			t.Fatalf("Error returned: %v", err)
 		}
 
 		line := "Eric loves pineapple pizza"
-		c, err := p.Write([]byte(line))
-		if err == nil && c != 0 {
+		if _, err := p.Write([]byte(line)); err != nil {
+			t.Fatalf("Buffered write returned an error: %v", err)
+		}
+
+		if err := p.(Flusher).Flush(); err == nil {
 			t.Fatalf("Error not returned")
 		}
 	})
+
+	t.Run("Batch", func(t *testing.T) {
+		var calls [][]types.InputLogEvent
+		client := CallbackCloudWatchLogs{
+			DescribeLogGroupsFn: func(input *cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+				return &cloudwatchlogs.DescribeLogGroupsOutput{
+					LogGroups: []types.LogGroup{
+						{LogGroupName: input.LogGroupNamePrefix},
+					},
+				}, nil
+			},
+
+			CreateLogStreamFn: func(input *cloudwatchlogs.CreateLogStreamInput) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+				return nil, nil
+			},
+
+			PutLogEventsFn: func(input *cloudwatchlogs.PutLogEventsInput) (*cloudwatchlogs.PutLogEventsOutput, error) {
+				calls = append(calls, input.LogEvents)
+				return &cloudwatchlogs.PutLogEventsOutput{}, nil
+			},
+		}
+
+		p, err := NewCloudWatchLogsProviderV2(client, "pineapple-pizza")
+		if err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+
+		for i := 0; i < 100; i++ {
+			if _, err := p.Write([]byte("Eric loves pineapple pizza")); err != nil {
+				t.Fatalf("Error returned: %v", err)
+			}
+		}
+		if len(calls) != 1 {
+			t.Fatalf("Writes should be buffered, %d calls", len(calls))
+		}
+
+		if err := p.(Flusher).Flush(); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+		if len(calls) != 2 || len(calls[1]) != 100 {
+			t.Fatalf("Writes should be sent in one batch: %d calls", len(calls))
+		}
+
+		for i := 1; i < len(calls[1]); i++ {
+			if *calls[1][i].Timestamp < *calls[1][i-1].Timestamp {
+				t.Fatalf("Events out of order")
+			}
+		}
+
+		// an event larger than the limit is split, the batch is sent once full
+		if _, err := p.Write(make([]byte, maxEventBytes*5)); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+		if err := p.(Flusher).Flush(); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+		if len(calls) != 4 || len(calls[2])+len(calls[3]) != 5 {
+			t.Fatalf("Large write should be split over batches: %d calls", len(calls))
+		}
+	})
+
+	t.Run("Interval", func(t *testing.T) {
+		defer func(d time.Duration) { FlushInterval = d }(FlushInterval)
+		FlushInterval = 10 * time.Millisecond
+
+		sent := make(chan int, 2)
+		client := CallbackCloudWatchLogs{
+			DescribeLogGroupsFn: func(input *cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+				return &cloudwatchlogs.DescribeLogGroupsOutput{
+					LogGroups: []types.LogGroup{
+						{LogGroupName: input.LogGroupNamePrefix},
+					},
+				}, nil
+			},
+
+			CreateLogStreamFn: func(input *cloudwatchlogs.CreateLogStreamInput) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+				return nil, nil
+			},
+
+			PutLogEventsFn: func(input *cloudwatchlogs.PutLogEventsInput) (*cloudwatchlogs.PutLogEventsOutput, error) {
+				sent <- len(input.LogEvents)
+				return &cloudwatchlogs.PutLogEventsOutput{}, nil
+			},
+		}
+
+		p, err := NewCloudWatchLogsProviderV2(client, "pineapple-pizza")
+		if err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+		<-sent
+
+		if _, err := p.Write([]byte("Eric loves pineapple pizza")); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+
+		select {
+		case n := <-sent:
+			if n != 1 {
+				t.Fatalf("Incorrect batch size: %d", n)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Buffered events weren't sent after the interval")
+		}
+	})
+
+	t.Run("Sequence Token Recovery", func(t *testing.T) {
+		var tokens []string
+		client := CallbackCloudWatchLogs{
+			DescribeLogGroupsFn: func(input *cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+				return &cloudwatchlogs.DescribeLogGroupsOutput{
+					LogGroups: []types.LogGroup{
+						{LogGroupName: input.LogGroupNamePrefix},
+					},
+				}, nil
+			},
+
+			CreateLogStreamFn: func(input *cloudwatchlogs.CreateLogStreamInput) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+				return nil, nil
+			},
+
+			PutLogEventsFn: func(input *cloudwatchlogs.PutLogEventsInput) (*cloudwatchlogs.PutLogEventsOutput, error) {
+				tokens = append(tokens, aws.ToString(input.SequenceToken))
+				switch len(tokens) {
+				case 2:
+					return nil, &types.InvalidSequenceTokenException{ExpectedSequenceToken: aws.String("expected")}
+				case 3:
+					return nil, &types.ThrottlingException{}
+				case 5:
+					return nil, &types.DataAlreadyAcceptedException{ExpectedSequenceToken: aws.String("accepted")}
+				}
+				return &cloudwatchlogs.PutLogEventsOutput{NextSequenceToken: aws.String("next")}, nil
+			},
+		}
+
+		p, err := NewCloudWatchLogsProviderV2(client, "pineapple-pizza")
+		if err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+
+		if _, err := p.Write([]byte("Eric loves pineapple pizza")); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+		if err := p.(Flusher).Flush(); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+
+		if _, err := p.Write([]byte("Eric loves pineapple pizza")); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+		if err := p.(Flusher).Flush(); err != nil {
+			t.Fatalf("Already accepted data shouldn't error: %v", err)
+		}
+
+		want := []string{"", "next", "expected", "expected", "next"}
+		if len(tokens) != len(want) {
+			t.Fatalf("Incorrect calls: %v", tokens)
+		}
+		for i := range want {
+			if tokens[i] != want[i] {
+				t.Fatalf("Incorrect sequence tokens: %v, want %v", tokens, want)
+			}
+		}
+	})
+
+	t.Run("Write During Throttling", func(t *testing.T) {
+		sending := make(chan struct{})
+		written := make(chan struct{})
+		var calls int32
+		var blocked bool
+		client := CallbackCloudWatchLogs{
+			DescribeLogGroupsFn: func(input *cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+				return &cloudwatchlogs.DescribeLogGroupsOutput{
+					LogGroups: []types.LogGroup{
+						{LogGroupName: input.LogGroupNamePrefix},
+					},
+				}, nil
+			},
+
+			CreateLogStreamFn: func(input *cloudwatchlogs.CreateLogStreamInput) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+				return nil, nil
+			},
+
+			PutLogEventsFn: func(input *cloudwatchlogs.PutLogEventsInput) (*cloudwatchlogs.PutLogEventsOutput, error) {
+				if atomic.AddInt32(&calls, 1) != 2 {
+					return &cloudwatchlogs.PutLogEventsOutput{}, nil
+				}
+
+				// writes must not wait for a batch being sent
+				close(sending)
+				select {
+				case <-written:
+				case <-time.After(time.Second):
+					blocked = true
+				}
+				return nil, &types.ThrottlingException{}
+			},
+		}
+
+		p, err := NewCloudWatchLogsProviderV2(client, "pineapple-pizza")
+		if err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+
+		if _, err := p.Write([]byte("Eric loves pineapple pizza")); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+		go func() {
+			<-sending
+			_, _ = p.Write([]byte("Eric still loves pineapple pizza"))
+			close(written)
+		}()
+		if err := p.(Flusher).Flush(); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+
+		if blocked {
+			t.Fatalf("Write blocked by the batch being sent")
+		}
+	})
 }
 
-func TestCloudWatchLogGroupExists(t *testing.T) {
+func TestCloudWatchLogGroupExistsV2(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		client := CallbackCloudWatchLogs{
 			DescribeLogGroupsFn: func(input *cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
 				return &cloudwatchlogs.DescribeLogGroupsOutput{
-					LogGroups: []*cloudwatchlogs.LogGroup{
+					LogGroups: []types.LogGroup{
 						{LogGroupName: input.LogGroupNamePrefix},
 					},
 				}, nil
 			},
 		}
 
-		if _, err := CloudWatchLogGroupExists(client, "pineapple-pizza"); err != nil {
+		if _, err := CloudWatchLogGroupExistsV2(client, "pineapple-pizza"); err != nil {
 			t.Fatalf("Error returned: %v", err)
 		}
 	})
@@ -202,17 +431,17 @@ func TestCloudWatchLogGroupExists(t *testing.T) {
 	t.Run("Error", func(t *testing.T) {
 		client := CallbackCloudWatchLogs{
 			DescribeLogGroupsFn: func(input *cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
-				return nil, awserr.New("Invalid", "Invalid", nil)
+				return nil, &smithy.GenericAPIError{Code: "Invalid", Message: "Invalid"}
 			},
 		}
 
-		if _, err := CloudWatchLogGroupExists(client, "pineapple-pizza"); err == nil {
+		if _, err := CloudWatchLogGroupExistsV2(client, "pineapple-pizza"); err == nil {
 			t.Fatalf("Error not returned")
 		}
 	})
 }
 
-func TestCreateCloudWatchLogGroup(t *testing.T) {
+func TestCreateCloudWatchLogGroupV2(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		client := CallbackCloudWatchLogs{
 			CreateLogGroupFn: func(input *cloudwatchlogs.CreateLogGroupInput) (*cloudwatchlogs.CreateLogGroupOutput, error) {
@@ -220,7 +449,7 @@ func TestCreateCloudWatchLogGroup(t *testing.T) {
 			},
 		}
 
-		if err := CreateNewCloudWatchLogGroup(client, "pineapple-pizza"); err != nil {
+		if err := CreateNewCloudWatchLogGroupV2(client, "pineapple-pizza"); err != nil {
 			t.Fatalf("Error returned: %v", err)
 		}
 	})
@@ -228,37 +457,235 @@ func TestCreateCloudWatchLogGroup(t *testing.T) {
 	t.Run("Error", func(t *testing.T) {
 		client := CallbackCloudWatchLogs{
 			CreateLogGroupFn: func(input *cloudwatchlogs.CreateLogGroupInput) (*cloudwatchlogs.CreateLogGroupOutput, error) {
-				return nil, awserr.New("Invalid", "Invalid", nil)
+				return nil, &smithy.GenericAPIError{Code: "Invalid", Message: "Invalid"}
+			},
+		}
+
+		if err := CreateNewCloudWatchLogGroupV2(client, "pineapple-pizza"); err == nil {
+			t.Fatalf("Error not returned")
+		}
+	})
+
+	t.Run("Options", func(t *testing.T) {
+		var kmsKeyID string
+		var retention int32
+		client := CallbackCloudWatchLogs{
+			CreateLogGroupFn: func(input *cloudwatchlogs.CreateLogGroupInput) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+				kmsKeyID = aws.ToString(input.KmsKeyId)
+				return nil, nil
+			},
+			PutRetentionPolicyFn: func(input *cloudwatchlogs.PutRetentionPolicyInput) (*cloudwatchlogs.PutRetentionPolicyOutput, error) {
+				retention = aws.ToInt32(input.RetentionInDays)
+				return nil, nil
+			},
+		}
+
+		opts := LogGroupOptions{RetentionInDays: 14, KMSKeyID: "arn:aws:kms:us-east-1:123456789012:key/pizza"}
+		if err := CreateNewCloudWatchLogGroupV2(client, "pineapple-pizza", opts); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+
+		if kmsKeyID != opts.KMSKeyID || retention != opts.RetentionInDays {
+			t.Fatalf("Options not applied: %v %v", kmsKeyID, retention)
+		}
+	})
+
+	t.Run("Exists", func(t *testing.T) {
+		var kmsKeyID string
+		var retention int32
+		client := CallbackCloudWatchLogs{
+			CreateLogGroupFn: func(input *cloudwatchlogs.CreateLogGroupInput) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+				return nil, &types.ResourceAlreadyExistsException{Message: aws.String("exists")}
+			},
+			AssociateKmsKeyFn: func(input *cloudwatchlogs.AssociateKmsKeyInput) (*cloudwatchlogs.AssociateKmsKeyOutput, error) {
+				kmsKeyID = aws.ToString(input.KmsKeyId)
+				return nil, nil
+			},
+			PutRetentionPolicyFn: func(input *cloudwatchlogs.PutRetentionPolicyInput) (*cloudwatchlogs.PutRetentionPolicyOutput, error) {
+				retention = aws.ToInt32(input.RetentionInDays)
+				return nil, nil
+			},
+		}
+
+		opts := LogGroupOptions{RetentionInDays: 14, KMSKeyID: "arn:aws:kms:us-east-1:123456789012:key/pizza"}
+		if err := CreateNewCloudWatchLogGroupV2(client, "pineapple-pizza", opts); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+
+		if kmsKeyID != opts.KMSKeyID || retention != opts.RetentionInDays {
+			t.Fatalf("Options not applied: %v %v", kmsKeyID, retention)
+		}
+	})
+
+	t.Run("Exists KMS Error", func(t *testing.T) {
+		client := CallbackCloudWatchLogs{
+			CreateLogGroupFn: func(input *cloudwatchlogs.CreateLogGroupInput) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+				return nil, &types.ResourceAlreadyExistsException{Message: aws.String("exists")}
+			},
+			AssociateKmsKeyFn: func(input *cloudwatchlogs.AssociateKmsKeyInput) (*cloudwatchlogs.AssociateKmsKeyOutput, error) {
+				return nil, &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "denied"}
+			},
+		}
+
+		if err := CreateNewCloudWatchLogGroupV2(client, "pineapple-pizza", LogGroupOptions{KMSKeyID: "arn:aws:kms:us-east-1:123456789012:key/pizza"}); err == nil {
+			t.Fatalf("Error not returned")
+		}
+	})
+
+	t.Run("Retention Error", func(t *testing.T) {
+		client := CallbackCloudWatchLogs{
+			CreateLogGroupFn: func(input *cloudwatchlogs.CreateLogGroupInput) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+				return nil, nil
+			},
+			PutRetentionPolicyFn: func(input *cloudwatchlogs.PutRetentionPolicyInput) (*cloudwatchlogs.PutRetentionPolicyOutput, error) {
+				return nil, &smithy.GenericAPIError{Code: "InvalidParameterException", Message: "Invalid"}
 			},
 		}
 
-		if err := CreateNewCloudWatchLogGroup(client, "pineapple-pizza"); err == nil {
+		if err := CreateNewCloudWatchLogGroupV2(client, "pineapple-pizza", LogGroupOptions{RetentionInDays: 3}); err == nil {
 			t.Fatalf("Error not returned")
 		}
 	})
 }
 
-type CallbackCloudWatchLogs struct {
+func TestCreateNewLogStreamV2(t *testing.T) {
+	t.Run("Exists", func(t *testing.T) {
+		client := CallbackCloudWatchLogs{
+			CreateLogStreamFn: func(input *cloudwatchlogs.CreateLogStreamInput) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+				return nil, &types.ResourceAlreadyExistsException{Message: aws.String("exists")}
+			},
+		}
+
+		if err := CreateNewLogStreamV2(client, "pineapple-pizza", "MyStack/MyBucket"); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		client := CallbackCloudWatchLogs{
+			CreateLogStreamFn: func(input *cloudwatchlogs.CreateLogStreamInput) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+				return nil, &smithy.GenericAPIError{Code: "AccessDenied", Message: "denied"}
+			},
+		}
+
+		if err := CreateNewLogStreamV2(client, "pineapple-pizza", "MyStack/MyBucket"); err == nil {
+			t.Fatalf("Error not returned")
+		}
+	})
+}
+
+// MockCloudWatchLogsV1 mocks the calls of an AWS SDK for Go v1 CloudWatch Logs client.
+type MockCloudWatchLogsV1 struct {
 	cloudwatchlogsiface.CloudWatchLogsAPI
+	groups  []string
+	streams []string
+	tokens  []string
+	events  []string
+}
+
+func (m *MockCloudWatchLogsV1) DescribeLogGroups(in *cloudwatchlogsv1.DescribeLogGroupsInput) (*cloudwatchlogsv1.DescribeLogGroupsOutput, error) {
+	return &cloudwatchlogsv1.DescribeLogGroupsOutput{}, nil
+}
+
+func (m *MockCloudWatchLogsV1) CreateLogGroup(in *cloudwatchlogsv1.CreateLogGroupInput) (*cloudwatchlogsv1.CreateLogGroupOutput, error) {
+	m.groups = append(m.groups, awsv1.StringValue(in.LogGroupName))
+	return nil, nil
+}
 
-	DescribeLogGroupsFn func(input *cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error)
-	CreateLogGroupFn    func(input *cloudwatchlogs.CreateLogGroupInput) (*cloudwatchlogs.CreateLogGroupOutput, error)
-	CreateLogStreamFn   func(input *cloudwatchlogs.CreateLogStreamInput) (*cloudwatchlogs.CreateLogStreamOutput, error)
-	PutLogEventsFn      func(input *cloudwatchlogs.PutLogEventsInput) (*cloudwatchlogs.PutLogEventsOutput, error)
+func (m *MockCloudWatchLogsV1) CreateLogStream(in *cloudwatchlogsv1.CreateLogStreamInput) (*cloudwatchlogsv1.CreateLogStreamOutput, error) {
+	if len(m.streams) != 0 {
+		return nil, awserr.New(cloudwatchlogsv1.ErrCodeResourceAlreadyExistsException, "exists", nil)
+	}
+	m.streams = append(m.streams, awsv1.StringValue(in.LogStreamName))
+	return nil, nil
 }
 
-func (cwl CallbackCloudWatchLogs) DescribeLogGroups(input *cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+func (m *MockCloudWatchLogsV1) PutLogEvents(in *cloudwatchlogsv1.PutLogEventsInput) (*cloudwatchlogsv1.PutLogEventsOutput, error) {
+	m.tokens = append(m.tokens, awsv1.StringValue(in.SequenceToken))
+	if len(m.tokens) == 2 {
+		return nil, &cloudwatchlogsv1.InvalidSequenceTokenException{
+			Message_:              awsv1.String("invalid"),
+			ExpectedSequenceToken: awsv1.String("expected"),
+		}
+	}
+	for _, e := range in.LogEvents {
+		m.events = append(m.events, awsv1.StringValue(e.Message))
+	}
+	return &cloudwatchlogsv1.PutLogEventsOutput{NextSequenceToken: awsv1.String("next")}, nil
+}
+
+func TestNewCloudWatchLogsProvider(t *testing.T) {
+	client := &MockCloudWatchLogsV1{}
+
+	p, err := NewCloudWatchLogsProvider(client, "pineapple-pizza")
+	if err != nil {
+		t.Fatalf("Error returned: %v", err)
+	}
+	if len(client.groups) != 1 || client.groups[0] != "pineapple-pizza" || len(client.streams) != 1 {
+		t.Fatalf("Log group %v and streams %v not created", client.groups, client.streams)
+	}
+
+	if _, err := p.Write([]byte("Eric loves pineapple pizza")); err != nil {
+		t.Fatalf("Error returned: %v", err)
+	}
+	if err := p.(Flusher).Flush(); err != nil {
+		t.Fatalf("Error returned: %v", err)
+	}
+
+	want := []string{"", "next", "expected"}
+	if len(client.tokens) != len(want) {
+		t.Fatalf("Incorrect sequence tokens: %v, want %v", client.tokens, want)
+	}
+	for i := range want {
+		if client.tokens[i] != want[i] {
+			t.Fatalf("Incorrect sequence tokens: %v, want %v", client.tokens, want)
+		}
+	}
+	if len(client.events) != 2 || client.events[1] != "Eric loves pineapple pizza" {
+		t.Errorf("Incorrect events: %v", client.events)
+	}
+
+	// the deprecated helpers use the same client
+	if ok, err := CloudWatchLogGroupExists(client, "pineapple-pizza"); ok || err != nil {
+		t.Errorf("CloudWatchLogGroupExists() = %v, %v", ok, err)
+	}
+	if err := CreateNewLogStream(client, "pineapple-pizza", "MyStack/MyBucket"); err != nil {
+		t.Errorf("An existing log stream shouldn't be an error: %v", err)
+	}
+	if err := CreateNewCloudWatchLogGroup(client, "pineapple-pizza"); err != nil {
+		t.Errorf("Error returned: %v", err)
+	}
+}
+
+type CallbackCloudWatchLogs struct {
+	DescribeLogGroupsFn  func(input *cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error)
+	CreateLogGroupFn     func(input *cloudwatchlogs.CreateLogGroupInput) (*cloudwatchlogs.CreateLogGroupOutput, error)
+	CreateLogStreamFn    func(input *cloudwatchlogs.CreateLogStreamInput) (*cloudwatchlogs.CreateLogStreamOutput, error)
+	PutLogEventsFn       func(input *cloudwatchlogs.PutLogEventsInput) (*cloudwatchlogs.PutLogEventsOutput, error)
+	PutRetentionPolicyFn func(input *cloudwatchlogs.PutRetentionPolicyInput) (*cloudwatchlogs.PutRetentionPolicyOutput, error)
+	AssociateKmsKeyFn    func(input *cloudwatchlogs.AssociateKmsKeyInput) (*cloudwatchlogs.AssociateKmsKeyOutput, error)
+}
+
+func (cwl CallbackCloudWatchLogs) DescribeLogGroups(ctx context.Context, input *cloudwatchlogs.DescribeLogGroupsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
 	return cwl.DescribeLogGroupsFn(input)
 }
 
-func (cwl CallbackCloudWatchLogs) CreateLogGroup(input *cloudwatchlogs.CreateLogGroupInput) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+func (cwl CallbackCloudWatchLogs) CreateLogGroup(ctx context.Context, input *cloudwatchlogs.CreateLogGroupInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogGroupOutput, error) {
 	return cwl.CreateLogGroupFn(input)
 }
 
-func (cwl CallbackCloudWatchLogs) CreateLogStream(input *cloudwatchlogs.CreateLogStreamInput) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+func (cwl CallbackCloudWatchLogs) CreateLogStream(ctx context.Context, input *cloudwatchlogs.CreateLogStreamInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogStreamOutput, error) {
 	return cwl.CreateLogStreamFn(input)
 }
 
-func (cwl CallbackCloudWatchLogs) PutLogEvents(input *cloudwatchlogs.PutLogEventsInput) (*cloudwatchlogs.PutLogEventsOutput, error) {
+func (cwl CallbackCloudWatchLogs) PutLogEvents(ctx context.Context, input *cloudwatchlogs.PutLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error) {
 	return cwl.PutLogEventsFn(input)
 }
+
+func (cwl CallbackCloudWatchLogs) PutRetentionPolicy(ctx context.Context, input *cloudwatchlogs.PutRetentionPolicyInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutRetentionPolicyOutput, error) {
+	return cwl.PutRetentionPolicyFn(input)
+}
+
+func (cwl CallbackCloudWatchLogs) AssociateKmsKey(ctx context.Context, input *cloudwatchlogs.AssociateKmsKeyInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.AssociateKmsKeyOutput, error) {
+	return cwl.AssociateKmsKeyFn(input)
+}
@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"bytes"
+	"io"
+	"sync/atomic"
+)
+
+// correlationID is the ID of the current invocation.
+var correlationID atomic.Value
+
+// SetCorrelationID sets the ID of the current invocation, prefixed
+// to the provider log lines written from then on.
+func SetCorrelationID(id string) {
+	correlationID.Store(id)
+}
+
+// CorrelationID returns the ID of the current invocation, if any.
+func CorrelationID() string {
+	id, _ := correlationID.Load().(string)
+	return id
+}
+
+// correlationWriter prefixes each write with the correlation ID.
+//
+// JSON records are left untouched so they can still be parsed; they carry
+// the correlation ID as a field instead.
+type correlationWriter struct {
+	w io.Writer
+}
+
+// Write writes p to the underlying writer, prefixed with the correlation ID.
+func (c correlationWriter) Write(p []byte) (int, error) {
+	id := CorrelationID()
+	if len(id) == 0 || bytes.HasPrefix(p, []byte("{")) {
+		return c.w.Write(p)
+	}
+
+	b := make([]byte, 0, len(id)+3+len(p))
+	b = append(b, '[')
+	b = append(b, id...)
+	b = append(b, "] "...)
+	b = append(b, p...)
+
+	if _, err := c.w.Write(b); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,30 @@
+package logging
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCorrelationWriter(t *testing.T) {
+	defer SetCorrelationID("")
+
+	var buf bytes.Buffer
+	w := correlationWriter{w: &buf}
+
+	if _, err := w.Write([]byte("before\n")); err != nil {
+		t.Fatalf("Error returned: %v", err)
+	}
+
+	SetCorrelationID("123456-2")
+	if _, err := w.Write([]byte("metrics: publishing\n")); err != nil {
+		t.Fatalf("Error returned: %v", err)
+	}
+	if _, err := w.Write([]byte("{\"msg\":\"record\"}\n")); err != nil {
+		t.Fatalf("Error returned: %v", err)
+	}
+
+	want := "before\n[123456-2] metrics: publishing\n{\"msg\":\"record\"}\n"
+	if buf.String() != want {
+		t.Fatalf("Unexpected output: %q", buf.String())
+	}
+}
@@ -0,0 +1,132 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+const (
+	// LogStreamTemplateEnv is the environment variable holding the provider log stream
+	// name template, see NewDestination.
+	LogStreamTemplateEnv = "CFN_LOG_STREAM_TEMPLATE"
+
+	// LogRetentionEnv is the environment variable holding the retention, in days,
+	// of provider log groups created by the runtime.
+	LogRetentionEnv = "CFN_LOG_RETENTION_DAYS"
+
+	// LogKMSKeyEnv is the environment variable holding the ARN of the KMS key used to
+	// encrypt provider log groups created by the runtime.
+	LogKMSKeyEnv = "CFN_LOG_KMS_KEY_ID"
+)
+
+// maxLogStreamNameLength is the CloudWatch Logs limit on log stream names.
+const maxLogStreamNameLength = 512
+
+// invalidLogStreamChars replaces the characters CloudWatch Logs doesn't allow in a
+// log stream name.
+var invalidLogStreamChars = strings.NewReplacer(":", "_", "*", "_")
+
+// LogGroupOptions configures the log groups created by the runtime.
+//
+// The options only apply when the runtime creates a log group, or finds
+// another invocation created it first; log groups that existed before
+// are left untouched.
+type LogGroupOptions struct {
+	// RetentionInDays is the number of days log events are kept.
+	// Zero keeps them forever.
+	RetentionInDays int32
+
+	// KMSKeyID is the ARN of the KMS key used to encrypt the log group.
+	KMSKeyID string
+}
+
+// StreamNameFields are the fields available to a log stream name template.
+//
+// ClientRequestToken identifies the operation; the runtime sets it to a
+// hash of the bearer token, which must never be shown.
+type StreamNameFields struct {
+	StackName          string
+	LogicalResourceID  string
+	Action             string
+	ClientRequestToken string
+}
+
+// Destination configures where provider logs are written.
+type Destination struct {
+	LogGroupOptions
+
+	streamName *template.Template
+}
+
+// NewDestination creates a Destination naming log streams after streamNameTemplate.
+//
+// The template is a text/template executed with StreamNameFields, for example
+//
+//	"{{.StackName}}/{{.LogicalResourceID}}/{{.Action}}/{{.ClientRequestToken}}"
+//
+// An empty template keeps the default of a random log stream name.
+func NewDestination(streamNameTemplate string, opts LogGroupOptions) (Destination, error) {
+	d := Destination{
+		LogGroupOptions: opts,
+	}
+
+	if len(streamNameTemplate) == 0 {
+		return d, nil
+	}
+
+	tmpl, err := template.New("stream").Parse(streamNameTemplate)
+	if err != nil {
+		return d, fmt.Errorf("invalid log stream template: %w", err)
+	}
+	d.streamName = tmpl
+
+	return d, nil
+}
+
+// DestinationFromEnv reads the provider log destination from the environment.
+func DestinationFromEnv() (Destination, error) {
+	opts := LogGroupOptions{
+		KMSKeyID: os.Getenv(LogKMSKeyEnv),
+	}
+
+	if v := os.Getenv(LogRetentionEnv); len(v) != 0 {
+		days, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return Destination{}, fmt.Errorf("invalid %s: %w", LogRetentionEnv, err)
+		}
+		opts.RetentionInDays = int32(days)
+	}
+
+	return NewDestination(os.Getenv(LogStreamTemplateEnv), opts)
+}
+
+// StreamName renders the log stream name for an invocation.
+//
+// It returns an empty name when the destination has no template,
+// leaving the name to the runtime.
+func (d Destination) StreamName(f StreamNameFields) (string, error) {
+	if d.streamName == nil {
+		return "", nil
+	}
+
+	var b strings.Builder
+	if err := d.streamName.Execute(&b, f); err != nil {
+		return "", err
+	}
+
+	name := invalidLogStreamChars.Replace(b.String())
+	if len(name) > maxLogStreamNameLength {
+		// cut on a rune boundary, the name must stay valid UTF-8
+		n := maxLogStreamNameLength
+		for n > 0 && !utf8.RuneStart(name[n]) {
+			n--
+		}
+		name = name[:n]
+	}
+
+	return name, nil
+}
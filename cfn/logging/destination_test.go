@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDestination(t *testing.T) {
+	fields := StreamNameFields{
+		StackName:          "MyStack",
+		LogicalResourceID:  "MyBucket",
+		Action:             "CREATE",
+		ClientRequestToken: "ecba020e-b2e6-4742-a7d0-8a06ae7c4b2b",
+	}
+
+	for _, tt := range []struct {
+		name     string
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{"Default", "", "", false},
+		{"Template", "{{.StackName}}/{{.LogicalResourceID}}/{{.Action}}/{{.ClientRequestToken}}", "MyStack/MyBucket/CREATE/ecba020e-b2e6-4742-a7d0-8a06ae7c4b2b", false},
+		{"Invalid Characters", "{{.StackName}}:{{.Action}}*", "MyStack_CREATE_", false},
+		{"Unknown Field", "{{.Pizza}}", "", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDestination(tt.template, LogGroupOptions{})
+			if err != nil {
+				t.Fatalf("Error returned: %v", err)
+			}
+
+			got, err := d.StreamName(fields)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("Too Long", func(t *testing.T) {
+		d, err := NewDestination("{{.StackName}}", LogGroupOptions{})
+		if err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+
+		got, err := d.StreamName(StreamNameFields{StackName: strings.Repeat("a", 600)})
+		if err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+		if len(got) != maxLogStreamNameLength {
+			t.Fatalf("Stream name not truncated: %d", len(got))
+		}
+	})
+
+	t.Run("Too Long Multibyte", func(t *testing.T) {
+		d, err := NewDestination("a{{.StackName}}", LogGroupOptions{})
+		if err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+
+		// the 3 byte runes start after a 1 byte prefix, so byte 512 is inside one
+		got, err := d.StreamName(StreamNameFields{StackName: strings.Repeat("€", 200)})
+		if err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+		if !utf8.ValidString(got) || len(got) != maxLogStreamNameLength-1 {
+			t.Fatalf("Stream name not truncated on a rune boundary: %d %q", len(got), got[len(got)-3:])
+		}
+	})
+
+	t.Run("Invalid Template", func(t *testing.T) {
+		if _, err := NewDestination("{{.StackName", LogGroupOptions{}); err == nil {
+			t.Fatalf("Error not returned")
+		}
+	})
+
+	t.Run("Env", func(t *testing.T) {
+		t.Setenv(LogStreamTemplateEnv, "{{.StackName}}/{{.Action}}")
+		t.Setenv(LogRetentionEnv, "30")
+		t.Setenv(LogKMSKeyEnv, "arn:aws:kms:us-east-1:123456789012:key/pizza")
+
+		d, err := DestinationFromEnv()
+		if err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+		if d.RetentionInDays != 30 || d.KMSKeyID != "arn:aws:kms:us-east-1:123456789012:key/pizza" {
+			t.Fatalf("Unexpected options: %+v", d.LogGroupOptions)
+		}
+		if got, _ := d.StreamName(fields); got != "MyStack/CREATE" {
+			t.Fatalf("Unexpected stream name: %q", got)
+		}
+	})
+
+	t.Run("Env Invalid Retention", func(t *testing.T) {
+		t.Setenv(LogRetentionEnv, "forever")
+
+		if _, err := DestinationFromEnv(); err == nil {
+			t.Fatalf("Error not returned")
+		}
+	})
+}
@@ -1,6 +1,3 @@
-//go:build logging
-// +build logging
-
 /*
 Package logging provides support for logging to cloudwatch
 within resource providers.
@@ -11,6 +8,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"strconv"
 	"syscall"
 )
 
@@ -24,14 +22,51 @@ const (
 	loggerError = "Logger"
 )
 
-// SetProviderLogOutput ...
+// ProviderLogsEnv is the environment variable that turns shipping provider logs
+// to CloudWatch Logs off when set to false.
+const ProviderLogsEnv = "CFN_PROVIDER_LOGS"
+
+const (
+	// samLocalEnv is set when the provider runs in SAM CLI.
+	samLocalEnv = "AWS_SAM_LOCAL"
+
+	// forceIntegrationsEnv ships provider logs from SAM CLI anyway.
+	forceIntegrationsEnv = "AWS_FORCE_INTEGRATIONS"
+)
+
+// ProviderLogsEnabled reports whether provider logs are shipped, read from CFN_PROVIDER_LOGS.
+//
+// Shipping is on unless the variable is set to a false value. When it isn't set,
+// shipping is off in SAM CLI, unless AWS_FORCE_INTEGRATIONS is set.
+func ProviderLogsEnabled() bool {
+	v, err := strconv.ParseBool(os.Getenv(ProviderLogsEnv))
+	if err != nil {
+		return len(os.Getenv(samLocalEnv)) == 0 || len(os.Getenv(forceIntegrationsEnv)) != 0
+	}
+
+	return v
+}
+
+// SetProviderLogOutput sends the standard log output and the
+// loggers created by New to w, scrubbed with Redact and
+// prefixed with the correlation ID.
 func SetProviderLogOutput(w io.Writer) {
+	w = NewRedactingWriter(correlationWriter{w: w})
 
 	log.SetOutput(w)
 
 	providerLogOutput = w
 }
 
+// ProviderLogOutput returns the writer provider logs are sent to.
+func ProviderLogOutput() io.Writer {
+	if providerLogOutput != nil {
+		return providerLogOutput
+	}
+
+	return NewRedactingWriter(stdErr)
+}
+
 // New sets up a logger that writes to the stderr
 func New(prefix string) *log.Logger {
 	var w io.Writer
@@ -43,5 +78,5 @@ func New(prefix string) *log.Logger {
 	}
 
 	// we create our own stderr since we're going to nuke the existing one
-	return log.New(w, prefix, log.LstdFlags)
+	return log.New(NewRedactingWriter(w), prefix, log.LstdFlags)
 }
@@ -0,0 +1,34 @@
+package logging
+
+import (
+	"testing"
+)
+
+func TestProviderLogsEnabled(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		value    string
+		samLocal string
+		force    string
+		want     bool
+	}{
+		{"Unset", "", "", "", true},
+		{"True", "true", "", "", true},
+		{"False", "false", "", "", false},
+		{"Zero", "0", "", "", false},
+		{"Invalid", "pineapple", "", "", true},
+		{"SAM Local", "", "true", "", false},
+		{"SAM Local Forced", "", "true", "true", true},
+		{"SAM Local Enabled", "true", "true", "", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(ProviderLogsEnv, tt.value)
+			t.Setenv(samLocalEnv, tt.samLocal)
+			t.Setenv(forceIntegrationsEnv, tt.force)
+
+			if got := ProviderLogsEnabled(); got != tt.want {
+				t.Fatalf("ProviderLogsEnabled() = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
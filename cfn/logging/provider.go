@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"io"
+	"sync"
+)
+
+// ProviderLogWriter is an io.Writer that ships provider logs to CloudWatch Logs
+// and is re-bound on every invocation.
+//
+// Credentials passed in by CloudFormation are short lived and each event may name a
+// different log group, so the destination of a warm container can't be fixed by the
+// first event it receives. Until the writer is bound, or after binding fails,
+// writes go to the fallback writer.
+type ProviderLogWriter struct {
+	mu sync.Mutex
+
+	fallback io.Writer
+	opts     LogGroupOptions
+
+	provider      *cloudWatchLogsProvider
+	logGroupName  string
+	logStreamName string
+	identity      string
+}
+
+// NewProviderLogWriter creates an unbound ProviderLogWriter.
+//
+// opts apply to the log groups the writer has to create.
+func NewProviderLogWriter(fallback io.Writer, opts LogGroupOptions) *ProviderLogWriter {
+	return &ProviderLogWriter{
+		fallback: fallback,
+		opts:     opts,
+	}
+}
+
+// Bind points the writer at a log group using the supplied client.
+//
+// identity identifies the credentials the client signs requests with, such as their
+// access key ID. When neither the log group, the log stream nor the identity changed
+// since the last bind, the current log stream is kept and only the client is replaced;
+// otherwise the log stream is created. An empty logStreamName leaves the name
+// to the writer, see Destination.StreamName.
+func (w *ProviderLogWriter) Bind(client CloudWatchLogsAPI, logGroupName string, logStreamName string, identity string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.provider != nil && w.logGroupName == logGroupName && w.logStreamName == logStreamName && w.identity == identity {
+		w.provider.setClient(client)
+		return nil
+	}
+
+	// drop the stale binding so nothing is written with old credentials if this fails
+	if w.provider != nil {
+		if err := w.provider.Flush(); err != nil {
+			w.provider.logger.Printf("Unable to send provider logs: %v", err)
+		}
+		w.provider = nil
+	}
+
+	p, err := newCloudWatchLogsProvider(client, logGroupName, logStreamName, w.opts)
+	if err != nil {
+		return err
+	}
+
+	w.provider = p
+	w.logGroupName = logGroupName
+	w.logStreamName = logStreamName
+	w.identity = identity
+
+	return nil
+}
+
+// LogStreamName returns the name of the bound log stream, if any.
+func (w *ProviderLogWriter) LogStreamName() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.provider == nil {
+		return ""
+	}
+
+	return w.provider.logStreamName
+}
+
+// Write sends b to the bound log stream, or to the fallback writer when unbound.
+func (w *ProviderLogWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.provider == nil {
+		return w.fallback.Write(b)
+	}
+
+	return w.provider.Write(b)
+}
+
+// Flush sends the log lines buffered by the bound log stream.
+func (w *ProviderLogWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.provider == nil {
+		return nil
+	}
+
+	return w.provider.Flush()
+}
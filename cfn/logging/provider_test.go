@@ -0,0 +1,153 @@
+package logging
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/smithy-go"
+)
+
+// newRecordingCloudWatchLogs returns a client that records the streams created
+// and the messages written to them.
+func newRecordingCloudWatchLogs(streams *[]string, written *[]string) CallbackCloudWatchLogs {
+	return CallbackCloudWatchLogs{
+		DescribeLogGroupsFn: func(input *cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+			return &cloudwatchlogs.DescribeLogGroupsOutput{
+				LogGroups: []types.LogGroup{
+					{LogGroupName: input.LogGroupNamePrefix},
+				},
+			}, nil
+		},
+
+		CreateLogStreamFn: func(input *cloudwatchlogs.CreateLogStreamInput) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+			*streams = append(*streams, aws.ToString(input.LogGroupName)+"/"+aws.ToString(input.LogStreamName))
+			return nil, nil
+		},
+
+		PutLogEventsFn: func(input *cloudwatchlogs.PutLogEventsInput) (*cloudwatchlogs.PutLogEventsOutput, error) {
+			for _, e := range input.LogEvents {
+				*written = append(*written, aws.ToString(e.Message))
+			}
+			return &cloudwatchlogs.PutLogEventsOutput{
+				NextSequenceToken: aws.String("zomg"),
+			}, nil
+		},
+	}
+}
+
+func TestProviderLogWriter(t *testing.T) {
+	t.Run("Unbound", func(t *testing.T) {
+		var fallback bytes.Buffer
+		w := NewProviderLogWriter(&fallback, LogGroupOptions{})
+
+		if _, err := w.Write([]byte("pineapple")); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+		if fallback.String() != "pineapple" {
+			t.Fatalf("Fallback not written: %q", fallback.String())
+		}
+		if w.LogStreamName() != "" {
+			t.Fatalf("Unbound writer has a stream: %v", w.LogStreamName())
+		}
+	})
+
+	t.Run("Rebind", func(t *testing.T) {
+		var streams, written []string
+		var fallback bytes.Buffer
+		client := newRecordingCloudWatchLogs(&streams, &written)
+		w := NewProviderLogWriter(&fallback, LogGroupOptions{})
+
+		if err := w.Bind(client, "pineapple-pizza", "", "AKID1"); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+		first := w.LogStreamName()
+
+		// nothing changed, the stream is kept
+		if err := w.Bind(client, "pineapple-pizza", "", "AKID1"); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+		if len(streams) != 1 || w.LogStreamName() != first {
+			t.Fatalf("Stream should have been reused: %v", streams)
+		}
+
+		// new credentials rotate the stream
+		if err := w.Bind(client, "pineapple-pizza", "", "AKID2"); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+		if len(streams) != 2 || w.LogStreamName() == first {
+			t.Fatalf("Stream should have been rotated: %v", streams)
+		}
+
+		// a new log group rotates the stream
+		if err := w.Bind(client, "hawaiian-pizza", "", "AKID2"); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+		if len(streams) != 3 || streams[2][:len("hawaiian-pizza")] != "hawaiian-pizza" {
+			t.Fatalf("Stream should have been created in the new group: %v", streams)
+		}
+
+		if _, err := w.Write([]byte("Eric loves pineapple pizza")); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+		if written[len(written)-1] != "Eric loves pineapple pizza" || fallback.Len() != 0 {
+			t.Fatalf("Bound writer didn't write to the stream: %v", written)
+		}
+	})
+
+	t.Run("Named Stream", func(t *testing.T) {
+		var streams, written []string
+		var fallback bytes.Buffer
+		client := newRecordingCloudWatchLogs(&streams, &written)
+		w := NewProviderLogWriter(&fallback, LogGroupOptions{})
+
+		if err := w.Bind(client, "pineapple-pizza", "MyStack/MyBucket/CREATE", "AKID1"); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+		if err := w.Bind(client, "pineapple-pizza", "MyStack/MyBucket/CREATE", "AKID1"); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+		if err := w.Bind(client, "pineapple-pizza", "MyStack/MyBucket/UPDATE", "AKID1"); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+
+		want := []string{"pineapple-pizza/MyStack/MyBucket/CREATE", "pineapple-pizza/MyStack/MyBucket/UPDATE"}
+		if len(streams) != len(want) || streams[0] != want[0] || streams[1] != want[1] {
+			t.Fatalf("Unexpected streams: %v", streams)
+		}
+		if w.LogStreamName() != "MyStack/MyBucket/UPDATE" {
+			t.Fatalf("Unexpected stream name: %v", w.LogStreamName())
+		}
+	})
+
+	t.Run("Rebind Error", func(t *testing.T) {
+		var streams, written []string
+		var fallback bytes.Buffer
+		w := NewProviderLogWriter(&fallback, LogGroupOptions{})
+
+		if err := w.Bind(newRecordingCloudWatchLogs(&streams, &written), "pineapple-pizza", "", "AKID1"); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+
+		failing := CallbackCloudWatchLogs{
+			DescribeLogGroupsFn: func(input *cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+				return nil, &smithy.GenericAPIError{Code: "ExpiredToken", Message: "expired"}
+			},
+		}
+		if err := w.Bind(failing, "pineapple-pizza", "", "AKID2"); err == nil {
+			t.Fatalf("Error not returned")
+		}
+
+		if _, err := w.Write([]byte("pineapple")); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+		if fallback.String() != "pineapple" {
+			t.Fatalf("Failed bind should fall back: %q", fallback.String())
+		}
+	})
+}
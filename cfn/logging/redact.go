@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"io"
+	"regexp"
+	"sync"
+)
+
+// Redacted replaces secrets in log output.
+const Redacted = "[REDACTED]"
+
+var (
+	redactMu sync.RWMutex
+
+	// redactPatterns match secrets; when a pattern has a capturing group,
+	// the first group is kept and the rest of the match replaced.
+	redactPatterns = []*regexp.Regexp{
+		// AWS access key IDs
+		regexp.MustCompile(`\b(?:AKIA|ASIA|AIDA|AROA)[A-Z0-9]{16}\b`),
+		// secret access keys, session and bearer tokens following their name,
+		// including inside JSON that was itself escaped into a JSON string
+		regexp.MustCompile(`(?i)((?:secret_?access_?key|session_?token|bearer_?token)\\?"?\s*[:=]\s*\\?"?)[^"\\,\s}]+`),
+		// STS session tokens
+		regexp.MustCompile(`\b(?:IQoJb3JpZ2lu|FwoGZXIvYXdz)[A-Za-z0-9/+=]+`),
+		// HTTP bearer authorization
+		regexp.MustCompile(`(?i)(\bBearer\s+)[A-Za-z0-9\-._~+/]+=*`),
+	}
+)
+
+// RegisterRedactionPattern adds a pattern to scrub from all runtime output.
+//
+// If the pattern has a capturing group, the first group is kept so the
+// surrounding context stays readable:
+//
+//	// "token=abc" is written as "token=[REDACTED]"
+//	logging.RegisterRedactionPattern(regexp.MustCompile(`(token=)\w+`))
+func RegisterRedactionPattern(re *regexp.Regexp) {
+	redactMu.Lock()
+	defer redactMu.Unlock()
+
+	redactPatterns = append(redactPatterns, re)
+}
+
+// Redact scrubs AWS credentials, bearer tokens and registered patterns from s.
+func Redact(s string) string {
+	redactMu.RLock()
+	defer redactMu.RUnlock()
+
+	for _, re := range redactPatterns {
+		repl := Redacted
+		if re.NumSubexp() > 0 {
+			repl = "${1}" + Redacted
+		}
+		s = re.ReplaceAllString(s, repl)
+	}
+
+	return s
+}
+
+// redactingWriter scrubs secrets before writing to the underlying writer.
+type redactingWriter struct {
+	w io.Writer
+}
+
+// NewRedactingWriter returns a writer that scrubs each write with Redact.
+//
+// Secrets split across writes aren't detected; the loggers of the
+// runtime write whole lines.
+func NewRedactingWriter(w io.Writer) io.Writer {
+	if r, ok := w.(redactingWriter); ok {
+		return r
+	}
+
+	return redactingWriter{w: w}
+}
+
+// Write scrubs p and writes it to the underlying writer.
+func (r redactingWriter) Write(p []byte) (int, error) {
+	if _, err := r.w.Write([]byte(Redact(string(p)))); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,185 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// modelRedactor masks the models formatted with FormatModel.
+var modelRedactor *SchemaRedactor
+
+// maxSchemaDepth bounds how deep $ref chains are followed looking for sensitive properties.
+const maxSchemaDepth = 16
+
+// SchemaRedactor masks the writeOnlyProperties of a resource schema, and the
+// properties marked sensitive, in models formatted for logs.
+//
+// A property is marked sensitive with a "sensitive": true annotation in the
+// schema, or by passing its JSON pointer to NewSchemaRedactor.
+type SchemaRedactor struct {
+	paths [][]string
+}
+
+// NewSchemaRedactor creates a SchemaRedactor from a resource schema.
+//
+// sensitive lists extra properties to mask as JSON pointers, such as
+// "/properties/OauthToken" or "/properties/Tags/*/Value".
+func NewSchemaRedactor(schema []byte, sensitive ...string) (*SchemaRedactor, error) {
+	var s struct {
+		Properties          map[string]json.RawMessage `json:"properties"`
+		Definitions         map[string]json.RawMessage `json:"definitions"`
+		WriteOnlyProperties []string                   `json:"writeOnlyProperties"`
+	}
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return nil, fmt.Errorf("invalid resource schema: %w", err)
+	}
+
+	r := &SchemaRedactor{}
+	for _, p := range append(s.WriteOnlyProperties, sensitive...) {
+		r.paths = append(r.paths, pointerPath(p))
+	}
+
+	for name, raw := range s.Properties {
+		r.findSensitive(raw, s.Definitions, []string{name}, 0)
+	}
+
+	return r, nil
+}
+
+// pointerPath converts a JSON pointer such as /properties/A/B into the model path [A B].
+func pointerPath(pointer string) []string {
+	var path []string
+	for _, seg := range strings.Split(strings.TrimPrefix(pointer, "/properties"), "/") {
+		if len(seg) == 0 {
+			continue
+		}
+		path = append(path, strings.ReplaceAll(strings.ReplaceAll(seg, "~1", "/"), "~0", "~"))
+	}
+
+	return path
+}
+
+// findSensitive walks a property schema collecting the paths of sensitive properties.
+func (r *SchemaRedactor) findSensitive(raw json.RawMessage, definitions map[string]json.RawMessage, path []string, depth int) {
+	if depth > maxSchemaDepth {
+		return
+	}
+
+	var p struct {
+		Ref        string                     `json:"$ref"`
+		Sensitive  bool                       `json:"sensitive"`
+		Properties map[string]json.RawMessage `json:"properties"`
+		Items      json.RawMessage            `json:"items"`
+	}
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return
+	}
+
+	if p.Sensitive {
+		r.paths = append(r.paths, append([]string(nil), path...))
+		return
+	}
+
+	if def, ok := definitions[strings.TrimPrefix(p.Ref, "#/definitions/")]; ok && len(p.Ref) != 0 {
+		r.findSensitive(def, definitions, path, depth+1)
+	}
+
+	for name, child := range p.Properties {
+		r.findSensitive(child, definitions, append(path, name), depth+1)
+	}
+
+	if len(p.Items) != 0 {
+		r.findSensitive(p.Items, definitions, append(path, "*"), depth+1)
+	}
+}
+
+// Redact returns a copy of model, as decoded JSON, with the masked properties
+// replaced by Redacted.
+//
+// A nil SchemaRedactor returns the model unchanged.
+func (r *SchemaRedactor) Redact(model interface{}) (interface{}, error) {
+	if r == nil || len(r.paths) == 0 {
+		return model, nil
+	}
+
+	b, err := json.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+
+	for _, p := range r.paths {
+		v = mask(v, p)
+	}
+
+	return v, nil
+}
+
+// Format returns the model as redacted JSON, ready to be logged.
+func (r *SchemaRedactor) Format(model interface{}) string {
+	v, err := r.Redact(model)
+	if err != nil {
+		return Redacted
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return Redacted
+	}
+
+	return string(b)
+}
+
+// SetModelRedactor sets the SchemaRedactor masking the models formatted with
+// FormatModel, such as the ones of progress reports logged or written to files.
+func SetModelRedactor(r *SchemaRedactor) {
+	modelRedactor = r
+}
+
+// FormatModel returns a JSON model, such as the resource model of a progress
+// report, redacted with the SchemaRedactor set with SetModelRedactor.
+//
+// An empty model stays empty, and a model that isn't valid JSON is replaced
+// by Redacted as a whole.
+func FormatModel(model []byte) string {
+	if len(model) == 0 {
+		return ""
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(model, &v); err != nil {
+		return Redacted
+	}
+
+	return modelRedactor.Format(v)
+}
+
+// mask replaces the value at path in v.
+func mask(v interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		if v == nil {
+			return nil
+		}
+		return Redacted
+	}
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if child, ok := t[path[0]]; ok {
+			t[path[0]] = mask(child, path[1:])
+		}
+	case []interface{}:
+		if path[0] == "*" {
+			for i := range t {
+				t[i] = mask(t[i], path[1:])
+			}
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,134 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+var testSchema = []byte(`{
+    "typeName": "Example::GitHub::Repo",
+    "definitions": {
+        "Webhook": {
+            "type": "object",
+            "properties": {
+                "Url": {"type": "string"},
+                "Secret": {"type": "string", "sensitive": true}
+            }
+        }
+    },
+    "properties": {
+        "Name": {"type": "string"},
+        "OauthToken": {"type": "string"},
+        "Webhooks": {"type": "array", "items": {"$ref": "#/definitions/Webhook"}},
+        "Settings": {
+            "type": "object",
+            "properties": {
+                "Password": {"type": "string"}
+            }
+        }
+    },
+    "writeOnlyProperties": [
+        "/properties/OauthToken"
+    ]
+}`)
+
+type testWebhook struct {
+	Url    *string `json:",omitempty"`
+	Secret *string `json:",omitempty"`
+}
+
+type testSettings struct {
+	Password *string `json:",omitempty"`
+}
+
+type testModel struct {
+	Name       *string       `json:",omitempty"`
+	OauthToken *string       `json:",omitempty"`
+	Webhooks   []testWebhook `json:",omitempty"`
+	Settings   *testSettings `json:",omitempty"`
+}
+
+func str(s string) *string {
+	return &s
+}
+
+func TestSchemaRedactor(t *testing.T) {
+	r, err := NewSchemaRedactor(testSchema, "/properties/Settings/Password")
+	if err != nil {
+		t.Fatalf("Error returned: %v", err)
+	}
+
+	model := &testModel{
+		Name:       str("pineapple-pizza"),
+		OauthToken: str("ghp_abc123"),
+		Webhooks: []testWebhook{
+			{Url: str("https://example.com"), Secret: str("s3cr3t")},
+		},
+		Settings: &testSettings{Password: str("hunter2")},
+	}
+
+	want := `{"Name":"pineapple-pizza","OauthToken":"[REDACTED]","Settings":{"Password":"[REDACTED]"},"Webhooks":[{"Secret":"[REDACTED]","Url":"https://example.com"}]}`
+	if got := r.Format(model); got != want {
+		t.Fatalf("Format() = %s; want %s", got, want)
+	}
+
+	if *model.OauthToken != "ghp_abc123" {
+		t.Fatalf("Model was modified")
+	}
+
+	t.Run("Missing Properties", func(t *testing.T) {
+		if got := r.Format(&testModel{Name: str("pineapple-pizza")}); got != `{"Name":"pineapple-pizza"}` {
+			t.Fatalf("Unexpected output: %s", got)
+		}
+	})
+
+	t.Run("Invalid Schema", func(t *testing.T) {
+		if _, err := NewSchemaRedactor([]byte("pineapple")); err == nil {
+			t.Fatalf("Error not returned")
+		}
+	})
+
+	t.Run("Logger", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := NewLogger(&buf, slog.LevelInfo, RequestFields{}, r)
+		logger.Info("Creating repo", "model", model, "name", "pineapple-pizza")
+
+		if strings.Contains(buf.String(), "ghp_abc123") {
+			t.Fatalf("Write only property logged: %s", buf.String())
+		}
+
+		var record map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+		if record["name"] != "pineapple-pizza" {
+			t.Fatalf("Unexpected record: %v", record)
+		}
+	})
+}
+
+func TestFormatModel(t *testing.T) {
+	r, err := NewSchemaRedactor(testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetModelRedactor(r)
+	defer SetModelRedactor(nil)
+
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{`{"Name":"repo","OauthToken":"ghp_secret"}`, `{"Name":"repo","OauthToken":"[REDACTED]"}`},
+		{``, ``},
+		{`{"OauthToken":`, Redacted},
+	}
+	for _, tt := range tests {
+		if got := FormatModel([]byte(tt.model)); got != tt.want {
+			t.Errorf("FormatModel(%s) = %s; want %s", tt.model, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package logging
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	cloudwatchlogsv1 "github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/aws/smithy-go"
+)
+
+// cloudWatchLogsV1 adapts an AWS SDK for Go v1 client to CloudWatchLogsAPI.
+//
+// It calls the same methods as the provider used to, so clients mocking only
+// those keep working. Errors are returned as their SDK v2 equivalents, so the
+// provider recognizes them.
+type cloudWatchLogsV1 struct {
+	client cloudwatchlogsiface.CloudWatchLogsAPI
+}
+
+// DescribeLogGroups lists log groups with the v1 client.
+func (c cloudWatchLogsV1) DescribeLogGroups(ctx context.Context, params *cloudwatchlogs.DescribeLogGroupsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+	in := &cloudwatchlogsv1.DescribeLogGroupsInput{
+		LogGroupNamePrefix: params.LogGroupNamePrefix,
+		NextToken:          params.NextToken,
+	}
+	if params.Limit != nil {
+		in.Limit = aws.Int64(int64(*params.Limit))
+	}
+
+	resp, err := c.client.DescribeLogGroups(in)
+	if err != nil {
+		return nil, fromV1Error(err)
+	}
+
+	out := &cloudwatchlogs.DescribeLogGroupsOutput{}
+	if resp == nil {
+		return out, nil
+	}
+	out.NextToken = resp.NextToken
+	for _, g := range resp.LogGroups {
+		out.LogGroups = append(out.LogGroups, types.LogGroup{
+			Arn:          g.Arn,
+			KmsKeyId:     g.KmsKeyId,
+			LogGroupName: g.LogGroupName,
+		})
+	}
+
+	return out, nil
+}
+
+// CreateLogGroup creates a log group with the v1 client.
+func (c cloudWatchLogsV1) CreateLogGroup(ctx context.Context, params *cloudwatchlogs.CreateLogGroupInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+	if _, err := c.client.CreateLogGroup(&cloudwatchlogsv1.CreateLogGroupInput{
+		LogGroupName: params.LogGroupName,
+		KmsKeyId:     params.KmsKeyId,
+		Tags:         aws.StringMap(params.Tags),
+	}); err != nil {
+		return nil, fromV1Error(err)
+	}
+
+	return &cloudwatchlogs.CreateLogGroupOutput{}, nil
+}
+
+// CreateLogStream creates a log stream with the v1 client.
+func (c cloudWatchLogsV1) CreateLogStream(ctx context.Context, params *cloudwatchlogs.CreateLogStreamInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+	if _, err := c.client.CreateLogStream(&cloudwatchlogsv1.CreateLogStreamInput{
+		LogGroupName:  params.LogGroupName,
+		LogStreamName: params.LogStreamName,
+	}); err != nil {
+		return nil, fromV1Error(err)
+	}
+
+	return &cloudwatchlogs.CreateLogStreamOutput{}, nil
+}
+
+// PutLogEvents sends a batch with the v1 client.
+func (c cloudWatchLogsV1) PutLogEvents(ctx context.Context, params *cloudwatchlogs.PutLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	in := &cloudwatchlogsv1.PutLogEventsInput{
+		LogGroupName:  params.LogGroupName,
+		LogStreamName: params.LogStreamName,
+		SequenceToken: params.SequenceToken,
+	}
+	for _, e := range params.LogEvents {
+		in.LogEvents = append(in.LogEvents, &cloudwatchlogsv1.InputLogEvent{
+			Message:   e.Message,
+			Timestamp: e.Timestamp,
+		})
+	}
+
+	resp, err := c.client.PutLogEvents(in)
+	if err != nil {
+		return nil, fromV1Error(err)
+	}
+
+	if resp == nil {
+		return &cloudwatchlogs.PutLogEventsOutput{}, nil
+	}
+
+	return &cloudwatchlogs.PutLogEventsOutput{NextSequenceToken: resp.NextSequenceToken}, nil
+}
+
+// PutRetentionPolicy sets the retention of a log group with the v1 client.
+func (c cloudWatchLogsV1) PutRetentionPolicy(ctx context.Context, params *cloudwatchlogs.PutRetentionPolicyInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutRetentionPolicyOutput, error) {
+	in := &cloudwatchlogsv1.PutRetentionPolicyInput{
+		LogGroupName: params.LogGroupName,
+	}
+	if params.RetentionInDays != nil {
+		in.RetentionInDays = aws.Int64(int64(*params.RetentionInDays))
+	}
+
+	if _, err := c.client.PutRetentionPolicy(in); err != nil {
+		return nil, fromV1Error(err)
+	}
+
+	return &cloudwatchlogs.PutRetentionPolicyOutput{}, nil
+}
+
+// AssociateKmsKey sets the KMS key of a log group with the v1 client.
+func (c cloudWatchLogsV1) AssociateKmsKey(ctx context.Context, params *cloudwatchlogs.AssociateKmsKeyInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.AssociateKmsKeyOutput, error) {
+	if _, err := c.client.AssociateKmsKey(&cloudwatchlogsv1.AssociateKmsKeyInput{
+		LogGroupName: params.LogGroupName,
+		KmsKeyId:     params.KmsKeyId,
+	}); err != nil {
+		return nil, fromV1Error(err)
+	}
+
+	return &cloudwatchlogs.AssociateKmsKeyOutput{}, nil
+}
+
+// fromV1Error returns the SDK v2 equivalent of the SDK v1 errors the provider handles.
+func fromV1Error(err error) error {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return err
+	}
+
+	msg := aws.String(aerr.Message())
+	switch aerr.Code() {
+	case cloudwatchlogsv1.ErrCodeResourceAlreadyExistsException:
+		return &types.ResourceAlreadyExistsException{Message: msg}
+	case cloudwatchlogsv1.ErrCodeServiceUnavailableException:
+		return &types.ServiceUnavailableException{Message: msg}
+	case cloudwatchlogsv1.ErrCodeInvalidSequenceTokenException:
+		e := &types.InvalidSequenceTokenException{Message: msg}
+		var v1 *cloudwatchlogsv1.InvalidSequenceTokenException
+		if errors.As(err, &v1) {
+			e.ExpectedSequenceToken = v1.ExpectedSequenceToken
+		}
+		return e
+	case cloudwatchlogsv1.ErrCodeDataAlreadyAcceptedException:
+		e := &types.DataAlreadyAcceptedException{Message: msg}
+		var v1 *cloudwatchlogsv1.DataAlreadyAcceptedException
+		if errors.As(err, &v1) {
+			e.ExpectedSequenceToken = v1.ExpectedSequenceToken
+		}
+		return e
+	case "ThrottlingException":
+		return &smithy.GenericAPIError{Code: aerr.Code(), Message: aerr.Message()}
+	default:
+		return err
+	}
+}
@@ -0,0 +1,145 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// LogLevelEnv is the environment variable holding the level of the structured
+// logger, one of DEBUG, INFO, WARN or ERROR.
+const LogLevelEnv = "CFN_LOG_LEVEL"
+
+// typeConfigurationLevelKey is the type configuration property that overrides the log level.
+const typeConfigurationLevelKey = "LogLevel"
+
+// loggerKey is used to store a logger in a context.
+type loggerKey struct{}
+
+// RequestFields are attached to every record logged during an invocation.
+//
+// ClientRequestToken identifies the operation. It must never be the bearer
+// token, which authorizes progress reports to CloudFormation.
+type RequestFields struct {
+	Action             string
+	ResourceType       string
+	LogicalResourceID  string
+	StackID            string
+	ClientRequestToken string
+	CallbackAttempt    int
+	CorrelationID      string
+}
+
+// NewLogger creates a structured logger writing JSON records to w, carrying the request fields.
+//
+// When a SchemaRedactor is supplied, models and other composite values
+// logged as attributes are masked with it.
+//
+//	logger := NewLogger(os.Stderr, slog.LevelInfo, RequestFields{Action: "CREATE"}, nil)
+//	logger.Info("Creating bucket", "bucket", "pineapple-pizza")
+func NewLogger(w io.Writer, level slog.Leveler, f RequestFields, r *SchemaRedactor) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	if r != nil {
+		opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if a.Value.Kind() != slog.KindAny || !isModel(a.Value.Any()) {
+				return a
+			}
+
+			v, err := r.Redact(a.Value.Any())
+			if err != nil {
+				return slog.String(a.Key, Redacted)
+			}
+
+			return slog.Any(a.Key, v)
+		}
+	}
+	h := slog.NewJSONHandler(w, opts)
+
+	return slog.New(h).With(
+		slog.String("action", f.Action),
+		slog.String("resourceType", f.ResourceType),
+		slog.String("logicalResourceId", f.LogicalResourceID),
+		slog.String("stackId", f.StackID),
+		slog.String("clientRequestToken", f.ClientRequestToken),
+		slog.Int("callbackAttempt", f.CallbackAttempt),
+		slog.String("correlationId", f.CorrelationID),
+	)
+}
+
+// isModel reports whether v could be a resource model: a struct or map
+// that isn't an error.
+func isModel(v interface{}) bool {
+	if _, ok := v.(error); ok {
+		return false
+	}
+
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t != nil && (t.Kind() == reflect.Struct || t.Kind() == reflect.Map)
+}
+
+// ParseLevel parses a level name such as "DEBUG" or "warn".
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	err := l.UnmarshalText([]byte(strings.TrimSpace(s)))
+
+	return l, err
+}
+
+// LevelFromEnv reads the log level from CFN_LOG_LEVEL, defaulting to INFO.
+func LevelFromEnv() slog.Level {
+	l, err := ParseLevel(os.Getenv(LogLevelEnv))
+	if err != nil {
+		return slog.LevelInfo
+	}
+
+	return l
+}
+
+// LevelFromTypeConfiguration reads the log level from the LogLevel
+// property of a type configuration, if it has one.
+func LevelFromTypeConfiguration(body []byte) (slog.Level, bool) {
+	if len(body) == 0 {
+		return 0, false
+	}
+
+	var config map[string]interface{}
+	if err := json.Unmarshal(body, &config); err != nil {
+		return 0, false
+	}
+
+	s, ok := config[typeConfigurationLevelKey].(string)
+	if !ok {
+		return 0, false
+	}
+
+	l, err := ParseLevel(s)
+	if err != nil {
+		return 0, false
+	}
+
+	return l, true
+}
+
+// NewContext returns a copy of ctx carrying the logger.
+func NewContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger.
+//
+// During an invocation the default logger carries the request fields.
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+
+	return slog.Default()
+}
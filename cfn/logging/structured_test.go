@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, slog.LevelInfo, RequestFields{
+		Action:             "CREATE",
+		ResourceType:       "AWS::Test::TestModel",
+		LogicalResourceID:  "MyBucket",
+		StackID:            "arn:aws:cloudformation:us-east-1:123456789012:stack/MyStack/1a2b",
+		ClientRequestToken: "123456",
+		CallbackAttempt:    2,
+	}, nil)
+
+	logger.Debug("Dropped")
+	logger.Info("Eric loves pineapple pizza", "slices", 3)
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Record isn't a single JSON object: %v\n%s", err, buf.String())
+	}
+
+	for k, want := range map[string]interface{}{
+		"level":              "INFO",
+		"msg":                "Eric loves pineapple pizza",
+		"action":             "CREATE",
+		"resourceType":       "AWS::Test::TestModel",
+		"logicalResourceId":  "MyBucket",
+		"stackId":            "arn:aws:cloudformation:us-east-1:123456789012:stack/MyStack/1a2b",
+		"clientRequestToken": "123456",
+		"callbackAttempt":    float64(2),
+		"slices":             float64(3),
+	} {
+		if record[k] != want {
+			t.Errorf("%s = %v; want %v", k, record[k], want)
+		}
+	}
+}
+
+func TestLevels(t *testing.T) {
+	t.Run("Env", func(t *testing.T) {
+		t.Setenv(LogLevelEnv, "debug")
+		if l := LevelFromEnv(); l != slog.LevelDebug {
+			t.Fatalf("Unexpected level: %v", l)
+		}
+	})
+
+	t.Run("Env Invalid", func(t *testing.T) {
+		t.Setenv(LogLevelEnv, "pineapple")
+		if l := LevelFromEnv(); l != slog.LevelInfo {
+			t.Fatalf("Unexpected level: %v", l)
+		}
+	})
+
+	for _, tt := range []struct {
+		name   string
+		body   string
+		want   slog.Level
+		wantOk bool
+	}{
+		{"Type Configuration", `{"LogLevel": "WARN"}`, slog.LevelWarn, true},
+		{"Type Configuration Missing", `{"Token": "abc"}`, 0, false},
+		{"Type Configuration Invalid", `{"LogLevel": "pineapple"}`, 0, false},
+		{"Type Configuration Empty", ``, 0, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			l, ok := LevelFromTypeConfiguration([]byte(tt.body))
+			if l != tt.want || ok != tt.wantOk {
+				t.Fatalf("LevelFromTypeConfiguration() = %v, %v; want %v, %v", l, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if FromContext(context.Background()) != slog.Default() {
+		t.Fatalf("Expected the default logger")
+	}
+
+	logger := slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil))
+	if FromContext(NewContext(context.Background(), logger)) != logger {
+		t.Fatalf("Expected the context logger")
+	}
+}
@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxEMFValues is the maximum number of values of a metric in an EMF record.
+const maxEMFValues = 100
+
+// emfCorrelationID is the property of EMF records holding the correlation ID,
+// which can be searched but isn't a dimension.
+const emfCorrelationID = "CorrelationId"
+
+// NewEMF creates a Publisher that writes metrics to w as CloudWatch Embedded
+// Metric Format records, one JSON record per line.
+//
+// When w is a CloudWatch Logs log stream, CloudWatch extracts the metrics from
+// the records, so publishing needs neither the cloudwatch:PutMetricData permission
+// nor a call to the API. The correlation ID is kept as a searchable property
+// rather than a dimension.
+func NewEMF(w io.Writer, resType string) *Publisher {
+	return NewWithSink(NewEMFSink(w), resType)
+}
+
+// emfSink writes metrics as EMF records.
+type emfSink struct {
+	w io.Writer
+}
+
+// NewEMFSink creates a Sink writing metrics to w as Embedded Metric Format records.
+func NewEMFSink(w io.Writer) Sink {
+	return &emfSink{w: w}
+}
+
+// emfDirective is the _aws member of an EMF record.
+type emfDirective struct {
+	Timestamp         int64             `json:"Timestamp"`
+	CloudWatchMetrics []emfMetricsGroup `json:"CloudWatchMetrics"`
+}
+
+type emfMetricsGroup struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit,omitempty"`
+}
+
+// Write writes one record per set of dimensions.
+func (s *emfSink) Write(ctx context.Context, b Batch) error {
+	var keys []string
+	groups := map[string][]Metric{}
+	for _, m := range b.Metrics {
+		var k strings.Builder
+		for _, name := range m.dimensionNames() {
+			fmt.Fprintf(&k, "|%s=%s", name, m.Dimensions[name])
+		}
+
+		key := k.String()
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], m)
+	}
+
+	var errs []error
+	for _, key := range keys {
+		// a record holds at most maxEMFValues values per metric
+		for offset := 0; ; offset += maxEMFValues {
+			record, more := emfRecord(b, groups[key], offset)
+			if record == nil {
+				break
+			}
+
+			line, err := json.Marshal(record)
+			if err != nil {
+				errs = append(errs, err)
+				break
+			}
+
+			if _, err := s.w.Write(append(line, '\n')); err != nil {
+				errs = append(errs, err)
+			}
+
+			if !more {
+				break
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// emfRecord builds the record of metrics sharing the same dimensions with the
+// values from offset, reporting whether values are left for another record.
+func emfRecord(b Batch, metrics []Metric, offset int) (map[string]interface{}, bool) {
+	record := map[string]interface{}{}
+	group := emfMetricsGroup{
+		Namespace:  b.Namespace,
+		Dimensions: [][]string{metrics[0].dimensionNames()},
+	}
+	for k, v := range metrics[0].Dimensions {
+		record[k] = v
+	}
+
+	timestamp := metrics[0].Timestamp
+	more := false
+	for _, m := range metrics {
+		if offset >= len(m.Values) {
+			continue
+		}
+
+		values := m.Values[offset:]
+		if len(values) > maxEMFValues {
+			values = values[:maxEMFValues]
+			more = true
+		}
+
+		group.Metrics = append(group.Metrics, emfMetric{Name: m.Name, Unit: string(m.Unit)})
+		if len(values) == 1 {
+			record[m.Name] = values[0]
+		} else {
+			record[m.Name] = values
+		}
+
+		if m.Timestamp.Before(timestamp) {
+			timestamp = m.Timestamp
+		}
+	}
+
+	if len(group.Metrics) == 0 {
+		return nil, false
+	}
+
+	if len(b.CorrelationID) != 0 {
+		record[emfCorrelationID] = b.CorrelationID
+	}
+
+	record["_aws"] = emfDirective{
+		Timestamp:         timestamp.UnixMilli(),
+		CloudWatchMetrics: []emfMetricsGroup{group},
+	}
+
+	return record, more
+}
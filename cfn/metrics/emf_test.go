@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewEMF(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewEMF(&buf, "foo::bar::test")
+	p.SetCorrelationID("123456-1")
+
+	now := time.Now()
+	p.PublishInvocationMetric(now, "CREATE")
+	p.Recorder("CREATE").Count("StabilizationPolls", 1)
+	p.Recorder("CREATE").Count("StabilizationPolls", 2)
+	p.PublishExceptionMetric(now, "CREATE", errors.New("failed to create resource"))
+
+	if buf.Len() != 0 {
+		t.Fatalf("Metrics written before Flush")
+	}
+	if err := p.Flush(context.Background()); err != nil {
+		t.Fatalf("Error returned: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 records, got %d: %s", len(lines), buf.String())
+	}
+
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("Invalid record: %v", err)
+	}
+
+	if record[DimensionKeyAcionType] != "CREATE" || record[DimensionKeyResourceType] != "foo/bar/test" {
+		t.Errorf("Record dimensions = %v", record)
+	}
+	if record[MetricNameHanderInvocationCount] != float64(1) {
+		t.Errorf("Invocation value = %v; want 1", record[MetricNameHanderInvocationCount])
+	}
+	if d, ok := record["StabilizationPolls"].([]interface{}); !ok || len(d) != 2 {
+		t.Errorf("StabilizationPolls values = %v; want [1 2]", record["StabilizationPolls"])
+	}
+	if record[emfCorrelationID] != "123456-1" {
+		t.Errorf("Record correlation ID = %v", record[emfCorrelationID])
+	}
+
+	var directive struct {
+		AWS emfDirective `json:"_aws"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &directive); err != nil {
+		t.Fatalf("Invalid record: %v", err)
+	}
+	if directive.AWS.Timestamp != now.UnixMilli() {
+		t.Errorf("Timestamp = %d; want %d", directive.AWS.Timestamp, now.UnixMilli())
+	}
+	group := directive.AWS.CloudWatchMetrics[0]
+	if group.Namespace != "AWS/CloudFormation/foo/bar/test" || len(group.Metrics) != 2 || len(group.Dimensions[0]) != 2 {
+		t.Errorf("Metrics group = %+v", group)
+	}
+
+	if !strings.Contains(lines[1], `"Name":"HandlerException"`) || strings.Contains(lines[1], `"CorrelationId"]`) {
+		t.Errorf("Exception record = %s; want CorrelationId as a property", lines[1])
+	}
+}
+
+func TestNewEMF_Chunks(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewEMF(&buf, "foo::bar::test")
+
+	for i := 0; i < maxEMFValues+1; i++ {
+		p.PublishDurationMetric(time.Now(), "CREATE", float64(i), "")
+	}
+	if err := p.Flush(context.Background()); err != nil {
+		t.Fatalf("Error returned: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(lines))
+	}
+}
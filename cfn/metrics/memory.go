@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+)
+
+// A MemorySink keeps the metrics written to it, so tests can assert on them.
+//
+//	sink := metrics.NewMemorySink()
+//	cfn.Start(h, cfn.WithMetricsSink(sink))
+//	...
+//	if sink.Count(metrics.MetricNameHanderException, nil) != 0 {
+//		t.Error("Expected no exceptions")
+//	}
+type MemorySink struct {
+	mu      sync.Mutex
+	batches []Batch
+}
+
+// NewMemorySink creates an empty MemorySink.
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+// Write keeps the batch.
+func (s *MemorySink) Write(ctx context.Context, b Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batches = append(s.batches, b)
+
+	return nil
+}
+
+// Batches returns the batches written so far.
+func (s *MemorySink) Batches() []Batch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Batch(nil), s.batches...)
+}
+
+// Metrics returns the metrics written so far, in order.
+func (s *MemorySink) Metrics() []Metric {
+	var metrics []Metric
+	for _, b := range s.Batches() {
+		metrics = append(metrics, b.Metrics...)
+	}
+
+	return metrics
+}
+
+// Find returns the metrics with the name that have all the given dimensions.
+func (s *MemorySink) Find(name string, dimensions map[string]string) []Metric {
+	var found []Metric
+	for _, m := range s.Metrics() {
+		if m.Name == name && hasDimensions(m, dimensions) {
+			found = append(found, m)
+		}
+	}
+
+	return found
+}
+
+// Count returns the number of values of the metrics matched by Find.
+func (s *MemorySink) Count(name string, dimensions map[string]string) int {
+	var n int
+	for _, m := range s.Find(name, dimensions) {
+		n += m.Count()
+	}
+
+	return n
+}
+
+// Sum returns the sum of the values of the metrics matched by Find.
+func (s *MemorySink) Sum(name string, dimensions map[string]string) float64 {
+	var sum float64
+	for _, m := range s.Find(name, dimensions) {
+		sum += m.Sum()
+	}
+
+	return sum
+}
+
+// Reset drops the metrics written so far.
+func (s *MemorySink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batches = nil
+}
+
+// hasDimensions reports whether m has all the dimensions.
+func hasDimensions(m Metric, dimensions map[string]string) bool {
+	for k, v := range dimensions {
+		if m.Dimensions[k] != v {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,184 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// promPrefix prefixes the names of the metrics in Prometheus files.
+const promPrefix = "cfn_"
+
+// promEscaper escapes label values.
+var promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// promSeries is the running total of a metric with a set of labels.
+type promSeries struct {
+	labels     string
+	count, sum float64
+}
+
+// promFamily is a metric with all its series.
+type promFamily struct {
+	name    string
+	counter bool
+	series  map[string]*promSeries
+}
+
+// prometheusSink writes metrics to a file in the Prometheus text format.
+type prometheusSink struct {
+	mu       sync.Mutex
+	path     string
+	families map[string]*promFamily
+}
+
+// NewPrometheusSink creates a Sink keeping the totals of the metrics written to it,
+// and writing them to path in the Prometheus text format after each batch.
+//
+// The file is replaced atomically, so it can be read by the textfile collector
+// of the node exporter. Metrics counted in units of Count are exposed as counters
+// and others as summaries, with their dimensions as labels:
+//
+//	# TYPE cfn_handler_invocation_count_total counter
+//	cfn_handler_invocation_count_total{action="CREATE",resource_type="Org/Service/Resource"} 3
+func NewPrometheusSink(path string) Sink {
+	return &prometheusSink{
+		path:     path,
+		families: map[string]*promFamily{},
+	}
+}
+
+// Write adds the metrics to the totals and rewrites the file.
+func (s *prometheusSink) Write(ctx context.Context, b Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range b.Metrics {
+		name := promPrefix + promName(m.Name)
+		counter := m.Unit == types.StandardUnitCount
+		if counter {
+			name += "_total"
+		} else if m.Unit != types.StandardUnitNone && len(m.Unit) != 0 {
+			name += "_" + promName(string(m.Unit))
+		}
+
+		f, ok := s.families[name]
+		if !ok {
+			f = &promFamily{name: name, counter: counter, series: map[string]*promSeries{}}
+			s.families[name] = f
+		}
+
+		labels := promLabels(m)
+		series, ok := f.series[labels]
+		if !ok {
+			series = &promSeries{labels: labels}
+			f.series[labels] = series
+		}
+		series.count += float64(m.Count())
+		series.sum += m.Sum()
+	}
+
+	return s.writeFile()
+}
+
+// writeFile writes the totals to a temporary file renamed over the destination.
+func (s *prometheusSink) writeFile() error {
+	names := make([]string, 0, len(s.families))
+	for name := range s.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out strings.Builder
+	for _, name := range names {
+		f := s.families[name]
+
+		labels := make([]string, 0, len(f.series))
+		for l := range f.series {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+
+		if f.counter {
+			fmt.Fprintf(&out, "# TYPE %s counter\n", name)
+			for _, l := range labels {
+				fmt.Fprintf(&out, "%s%s %s\n", name, l, promValue(f.series[l].sum))
+			}
+			continue
+		}
+
+		fmt.Fprintf(&out, "# TYPE %s summary\n", name)
+		for _, l := range labels {
+			fmt.Fprintf(&out, "%s_sum%s %s\n", name, l, promValue(f.series[l].sum))
+			fmt.Fprintf(&out, "%s_count%s %s\n", name, l, promValue(f.series[l].count))
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), "."+filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(out.String()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// promLabels formats the dimensions of m as sorted Prometheus labels.
+func promLabels(m Metric) string {
+	names := m.dimensionNames()
+	if len(names) == 0 {
+		return ""
+	}
+
+	labels := make([]string, 0, len(names))
+	for _, k := range names {
+		labels = append(labels, fmt.Sprintf(`%s="%s"`, promName(k), promEscaper.Replace(m.Dimensions[k])))
+	}
+
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+// promName converts a CloudWatch name such as HandlerInvocationCount or
+// Bytes/Second into a Prometheus name such as handler_invocation_count.
+func promName(s string) string {
+	var b strings.Builder
+	prev := '_'
+	for _, r := range s {
+		switch {
+		case unicode.IsUpper(r):
+			if prev != '_' && !unicode.IsUpper(prev) {
+				b.WriteByte('_')
+			}
+		case r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)):
+			r = '_'
+			if prev == '_' {
+				continue
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+		prev = r
+	}
+
+	return strings.Trim(b.String(), "_")
+}
+
+// promValue formats a sample value.
+func promValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
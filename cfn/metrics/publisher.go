@@ -1,15 +1,18 @@
 package metrics
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/logging"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/cfnerr"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
 	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
 )
 
@@ -22,47 +25,128 @@ const (
 	MetricNameHanderDuration = "HandlerInvocationDuration"
 	// MetricNameHanderInvocationCount is a metric type.
 	MetricNameHanderInvocationCount = "HandlerInvocationCount"
+	// MetricNameAPICallCount is a metric type.
+	MetricNameAPICallCount = "HandlerAPICallCount"
+	// MetricNameOperationDuration is a metric type.
+	MetricNameOperationDuration = "OperationDuration"
+	// MetricNameOperationAttempts is a metric type.
+	MetricNameOperationAttempts = "OperationAttempts"
+	// MetricNameOperationStatus is a metric type.
+	MetricNameOperationStatus = "OperationStatus"
 	// DimensionKeyAcionType  is the Action key in the dimension.
 	DimensionKeyAcionType = "Action"
 	// DimensionKeyExceptionType  is the ExceptionType in the dimension.
 	DimensionKeyExceptionType = "ExceptionType"
 	// DimensionKeyResourceType  is the ResourceType in the dimension.
 	DimensionKeyResourceType = "ResourceType"
+	// DimensionKeyService is the Service of an AWS API call in the dimension.
+	DimensionKeyService = "Service"
+	// DimensionKeyOperation is the Operation of an AWS API call in the dimension.
+	DimensionKeyOperation = "Operation"
+	// DimensionKeyOperationStatus is the OperationStatus in the dimension.
+	DimensionKeyOperationStatus = "OperationStatus"
+	// DimensionKeyHandlerErrorCode is the HandlerErrorCode in the dimension.
+	DimensionKeyHandlerErrorCode = "HandlerErrorCode"
+	// ExceptionTypeUnknown is the ExceptionType of errors without a code.
+	ExceptionTypeUnknown = "Unknown"
+	// HandlerErrorCodeNone is the HandlerErrorCode of invocations that didn't fail.
+	HandlerErrorCodeNone = "None"
 	// ServiceInternalError ...
 	ServiceInternalError string = "ServiceInternal"
 )
 
+// maxDatumsPerCall is the maximum number of datums in a PutMetricData call.
+const maxDatumsPerCall = 1000
+
+// CloudWatchAPI is the subset of the CloudWatch API used by the Publisher.
+//
+// It is satisfied by the AWS SDK for Go v2 client, *cloudwatch.Client.
+type CloudWatchAPI interface {
+	PutMetricData(ctx context.Context, params *cloudwatch.PutMetricDataInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricDataOutput, error)
+}
+
 // A Publisher represents an object that publishes metrics to AWS Cloudwatch.
+//
+// Metrics are aggregated in memory and only written to the Sink when Flush is
+// called, so publishing never blocks the handler on a round trip to CloudWatch.
 type Publisher struct {
-	client       cloudwatchiface.CloudWatchAPI // AWS CloudWatch Service Client
-	namespace    string                        // custom resouces's namespace
-	logger       *log.Logger
-	resourceType string // type of resource
+	sink          Sink   // destination of the metrics
+	namespace     string // custom resouces's namespace
+	resourceType  string // type of resource
+	correlationID string // ID of the invocation
+
+	mu      sync.Mutex
+	pending map[string]*Metric
+	order   []string
 }
 
-// New creates a new Publisher.
+// New creates a new Publisher sending metrics to CloudWatch with a client
+// of the AWS SDK for Go v1.
+//
+// Deprecated: use NewV2 with a client of the AWS SDK for Go v2.
 func New(client cloudwatchiface.CloudWatchAPI, resType string) *Publisher {
-	if len(os.Getenv("AWS_SAM_LOCAL")) > 0 {
-		client = newNoopClient()
-	}
+	return NewV2(cloudWatchV1{client: client}, resType)
+}
+
+// NewV2 creates a new Publisher sending metrics to CloudWatch with client.
+func NewV2(client CloudWatchAPI, resType string) *Publisher {
+	return NewWithSink(NewCloudWatchSink(client), resType)
+}
+
+// NewWithSink creates a new Publisher writing metrics to s.
+func NewWithSink(s Sink, resType string) *Publisher {
 	rn := ResourceTypeName(resType)
 	return &Publisher{
-		client:       client,
-		logger:       logging.New("metrics"),
+		sink:         s,
 		namespace:    fmt.Sprintf("%s/%s", MetricNameSpaceRoot, rn),
 		resourceType: rn,
+		pending:      map[string]*Metric{},
+	}
+}
+
+// SetCorrelationID sets the ID of the invocation the metrics are published for.
+//
+// The ID is unique to each invocation, so it's never a dimension: every value
+// would create a new metric and split the series alarms are set on. It's passed
+// to the Sink with the batch, see Batch.CorrelationID.
+func (p *Publisher) SetCorrelationID(id string) {
+	p.correlationID = id
+}
+
+// ExceptionType returns the ExceptionType dimension of an error: the code of a
+// cfnerr.Error or of an AWS API error, or ExceptionTypeUnknown.
+//
+// Messages often contain request IDs or ARNs, so they're never used as
+// dimensions; every distinct value would create a new metric.
+func ExceptionType(e error) string {
+	var coded cfnerr.Error
+	if errors.As(e, &coded) && len(coded.Code()) != 0 {
+		return coded.Code()
+	}
+
+	var api interface{ ErrorCode() string }
+	if errors.As(e, &api) && len(api.ErrorCode()) != 0 {
+		return api.ErrorCode()
 	}
+
+	return ExceptionTypeUnknown
 }
 
 // PublishExceptionMetric publishes an exception metric.
+//
+// The ExceptionType dimension is derived from the error code, see ExceptionType;
+// the full error is only logged. The dimensions are the same whatever the Sink,
+// so alarms keep working when the metrics format changes.
 func (p *Publisher) PublishExceptionMetric(date time.Time, action string, e error) {
-	v := strings.ReplaceAll(e.Error(), "\n", " ")
+	v := ExceptionType(e)
+	slog.Error("Handler exception", "exceptionType", v, "error", e.Error())
+
 	dimensions := map[string]string{
 		DimensionKeyAcionType:     string(action),
 		DimensionKeyExceptionType: v,
 		DimensionKeyResourceType:  p.resourceType,
 	}
-	p.publishMetric(MetricNameHanderException, dimensions, cloudwatch.StandardUnitCount, 1.0, date)
+	p.publishMetric(MetricNameHanderException, dimensions, types.StandardUnitCount, 1.0, date)
 }
 
 // PublishInvocationMetric publishes an invocation metric.
@@ -71,48 +155,114 @@ func (p *Publisher) PublishInvocationMetric(date time.Time, action string) {
 		DimensionKeyAcionType:    string(action),
 		DimensionKeyResourceType: p.resourceType,
 	}
-	p.publishMetric(MetricNameHanderInvocationCount, dimensions, cloudwatch.StandardUnitCount, 1.0, date)
+	p.publishMetric(MetricNameHanderInvocationCount, dimensions, types.StandardUnitCount, 1.0, date)
 }
 
 // PublishDurationMetric publishes an duration metric.
 //
-// A duration metric is the timing of something.
-func (p *Publisher) PublishDurationMetric(date time.Time, action string, secs float64) {
+// A duration metric is the timing of something. The HandlerErrorCode dimension
+// is the error code the handler returned, or HandlerErrorCodeNone, so latency
+// can be graphed by outcome.
+func (p *Publisher) PublishDurationMetric(date time.Time, action string, secs float64, errorCode string) {
+	if len(errorCode) == 0 {
+		errorCode = HandlerErrorCodeNone
+	}
+	dimensions := map[string]string{
+		DimensionKeyAcionType:        string(action),
+		DimensionKeyHandlerErrorCode: errorCode,
+		DimensionKeyResourceType:     p.resourceType,
+	}
+	p.publishMetric(MetricNameHanderDuration, dimensions, types.StandardUnitMilliseconds, secs, date)
+}
+
+// PublishAPICallMetric publishes the number of calls a handler made to an AWS API operation.
+func (p *Publisher) PublishAPICallMetric(date time.Time, action string, service string, operation string, calls float64) {
 	dimensions := map[string]string{
 		DimensionKeyAcionType:    string(action),
+		DimensionKeyOperation:    operation,
 		DimensionKeyResourceType: p.resourceType,
+		DimensionKeyService:      service,
 	}
-	p.publishMetric(MetricNameHanderDuration, dimensions, cloudwatch.StandardUnitMilliseconds, secs, date)
+	p.publishMetric(MetricNameAPICallCount, dimensions, types.StandardUnitCount, calls, date)
 }
 
-func (p *Publisher) publishMetric(metricName string, data map[string]string, unit string, value float64, date time.Time) {
+// PublishOperationMetrics publishes the metrics of an operation that reached
+// the terminal status, SUCCESS or FAILED.
+//
+// An operation spans all the invocations of a handler, from the first one to the
+// one returning a terminal status, so its duration includes the callback delays.
+func (p *Publisher) PublishOperationMetrics(date time.Time, action string, status string, attempts int, d time.Duration) {
+	dimensions := func() map[string]string {
+		return map[string]string{
+			DimensionKeyAcionType:       string(action),
+			DimensionKeyOperationStatus: status,
+			DimensionKeyResourceType:    p.resourceType,
+		}
+	}
+	p.publishMetric(MetricNameOperationStatus, dimensions(), types.StandardUnitCount, 1.0, date)
+	p.publishMetric(MetricNameOperationAttempts, dimensions(), types.StandardUnitCount, float64(attempts), date)
+	p.publishMetric(MetricNameOperationDuration, dimensions(), types.StandardUnitMilliseconds, d.Seconds()*1e3, date)
+}
+
+func (p *Publisher) publishMetric(metricName string, data map[string]string, unit types.StandardUnit, value float64, date time.Time) {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(metricName)
+	b.WriteString("|")
+	b.WriteString(string(unit))
+	for _, k := range keys {
+		fmt.Fprintf(&b, "|%s=%s", k, data[k])
+	}
+	key := b.String()
 
-	var d []*cloudwatch.Dimension
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	for k, v := range data {
-		dim := &cloudwatch.Dimension{
-			Name:  aws.String(k),
-			Value: aws.String(v),
+	m, ok := p.pending[key]
+	if !ok {
+		m = &Metric{
+			Name:       metricName,
+			Unit:       unit,
+			Dimensions: data,
+			Timestamp:  date,
 		}
-		d = append(d, dim)
+		p.pending[key] = m
+		p.order = append(p.order, key)
 	}
-	md := []*cloudwatch.MetricDatum{
-		{
-			MetricName: aws.String(metricName),
-			Unit:       aws.String(unit),
-			Value:      aws.Float64(value),
-			Dimensions: d,
-			Timestamp:  &date},
+	m.Values = append(m.Values, value)
+}
+
+// Flush writes the aggregated metrics to the Sink, giving up when ctx is done.
+//
+// The aggregated metrics are dropped whether or not they were written.
+func (p *Publisher) Flush(ctx context.Context) error {
+	p.mu.Lock()
+	metrics := make([]Metric, 0, len(p.order))
+	for _, key := range p.order {
+		metrics = append(metrics, *p.pending[key])
 	}
-	pi := cloudwatch.PutMetricDataInput{
-		Namespace:  aws.String(p.namespace),
-		MetricData: md,
+	p.pending = map[string]*Metric{}
+	p.order = nil
+	p.mu.Unlock()
+
+	if len(metrics) == 0 {
+		return nil
 	}
-	_, err := p.client.PutMetricData(&pi)
-	if err != nil {
-		p.logger.Printf("An error occurred while publishing metrics: %s", err)
 
+	if err := p.sink.Write(ctx, Batch{
+		Namespace:     p.namespace,
+		CorrelationID: p.correlationID,
+		Metrics:       metrics,
+	}); err != nil {
+		return fmt.Errorf("unable to publish metrics: %w", err)
 	}
+
+	return nil
 }
 
 // ResourceTypeName returns a type name by removing (::) and replaing with (/)
@@ -1,11 +1,20 @@
 package metrics
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
-	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/cfnerr"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go/aws"
+	cloudwatchv1 "github.com/aws/aws-sdk-go/service/cloudwatch"
 	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
 )
 
@@ -14,9 +23,8 @@ const failed = "\u2717"
 
 // Define a mock struct to be used in your unit tests of myFunc.
 type MockCloudWatchClient struct {
-	cloudwatchiface.CloudWatchAPI
 	MetricName string
-	Unit       string
+	Unit       types.StandardUnit
 	Value      float64
 	Dim        map[string]string
 }
@@ -25,7 +33,7 @@ func NewMockCloudWatchClient() *MockCloudWatchClient {
 	return &MockCloudWatchClient{}
 }
 
-func (m *MockCloudWatchClient) PutMetricData(in *cloudwatch.PutMetricDataInput) (*cloudwatch.PutMetricDataOutput, error) {
+func (m *MockCloudWatchClient) PutMetricData(ctx context.Context, in *cloudwatch.PutMetricDataInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricDataOutput, error) {
 
 	// copy dimension in to a map for searching
 
@@ -36,7 +44,7 @@ func (m *MockCloudWatchClient) PutMetricData(in *cloudwatch.PutMetricDataInput)
 	}
 
 	m.MetricName = *in.MetricData[0].MetricName
-	m.Unit = *in.MetricData[0].Unit
+	m.Unit = in.MetricData[0].Unit
 	m.Value = *in.MetricData[0].Value
 	m.Dim = d
 
@@ -44,21 +52,19 @@ func (m *MockCloudWatchClient) PutMetricData(in *cloudwatch.PutMetricDataInput)
 }
 
 // Define a mock struct to be used in your unit tests of myFunc.
-type MockCloudWatchClientError struct {
-	cloudwatchiface.CloudWatchAPI
-}
+type MockCloudWatchClientError struct{}
 
 func NewMockCloudWatchClientError() *MockCloudWatchClientError {
 	return &MockCloudWatchClientError{}
 }
 
-func (m *MockCloudWatchClientError) PutMetricData(in *cloudwatch.PutMetricDataInput) (*cloudwatch.PutMetricDataOutput, error) {
+func (m *MockCloudWatchClientError) PutMetricData(ctx context.Context, in *cloudwatch.PutMetricDataInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricDataOutput, error) {
 
 	return nil, errors.New("Error")
 }
 func TestPublisher_PublishExceptionMetric(t *testing.T) {
 	type fields struct {
-		Client  cloudwatchiface.CloudWatchAPI
+		Client  CloudWatchAPI
 		resName string
 	}
 	type args struct {
@@ -76,20 +82,23 @@ func TestPublisher_PublishExceptionMetric(t *testing.T) {
 		wantDimensionKeyExceptionType string
 		wantDimensionKeyResourceType  string
 		wantMetricName                string
-		wantUnit                      string
+		wantUnit                      types.StandardUnit
 		wantValue                     float64
 	}{
-		{"testPublisherPublishExceptionMetric", fields{NewMockCloudWatchClient(), "foo::bar::test"}, args{time.Now(), "CREATE", errors.New("failed to create\nresource")}, "HandlerException", false, "CREATE", "failed to create resource", "foo/bar/test", "HandlerException", cloudwatch.StandardUnitCount, 1.0},
-		{"testPublisherPublishExceptionMetricWantError", fields{NewMockCloudWatchClientError(), "foo::bar::test"}, args{time.Now(), "CREATE", errors.New("failed to create resource")}, "HandlerException", true, "CREATE", "failed to create resource", "foo/bar/test", "HandlerException", cloudwatch.StandardUnitCount, 1.0},
-		{"testPublisherPublishExceptionMetric", fields{NewMockCloudWatchClient(), "foo::bar::test"}, args{time.Now(), "UPDATE", errors.New("failed to create resource")}, "HandlerException", false, "UPDATE", "failed to create resource", "foo/bar/test", "HandlerException", cloudwatch.StandardUnitCount, 1.0},
-		{"testPublisherPublishExceptionMetricWantError", fields{NewMockCloudWatchClientError(), "foo::bar::test"}, args{time.Now(), "UPDATE", errors.New("failed to create resource")}, "HandlerException", true, "UPDATE", "failed to create resource", "foo/bar/test", "HandlerException", cloudwatch.StandardUnitCount, 1.0},
+		{"testPublisherPublishExceptionMetric", fields{NewMockCloudWatchClient(), "foo::bar::test"}, args{time.Now(), "CREATE", errors.New("failed to create\nresource")}, "HandlerException", false, "CREATE", ExceptionTypeUnknown, "foo/bar/test", "HandlerException", types.StandardUnitCount, 1.0},
+		{"testPublisherPublishExceptionMetricWantError", fields{NewMockCloudWatchClientError(), "foo::bar::test"}, args{time.Now(), "CREATE", errors.New("failed to create resource")}, "HandlerException", true, "CREATE", "failed to create resource", "foo/bar/test", "HandlerException", types.StandardUnitCount, 1.0},
+		{"testPublisherPublishExceptionMetric", fields{NewMockCloudWatchClient(), "foo::bar::test"}, args{time.Now(), "UPDATE", cfnerr.New("NotStabilized", "failed to create resource arn:aws:s3:::bucket", nil)}, "HandlerException", false, "UPDATE", "NotStabilized", "foo/bar/test", "HandlerException", types.StandardUnitCount, 1.0},
+		{"testPublisherPublishExceptionMetricWantError", fields{NewMockCloudWatchClientError(), "foo::bar::test"}, args{time.Now(), "UPDATE", errors.New("failed to create resource")}, "HandlerException", true, "UPDATE", "failed to create resource", "foo/bar/test", "HandlerException", types.StandardUnitCount, 1.0},
 	}
 	for i, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p := New(tt.fields.Client, tt.fields.resName)
+			p := NewV2(tt.fields.Client, tt.fields.resName)
 			t.Logf("\tTest: %d\tWhen checking %q for success", i, tt.name)
 			{
 				p.PublishExceptionMetric(tt.args.date, tt.args.action, tt.args.e)
+				if err := p.Flush(context.Background()); (err != nil) != tt.wantErr {
+					t.Errorf("\t%s\tFlush() error = %v, wantErr %v", failed, err, tt.wantErr)
+				}
 				t.Logf("\t%s\tShould be able to make the PublishExceptionMetric call.", succeed)
 				if !tt.wantErr {
 					e := tt.fields.Client.(*MockCloudWatchClient)
@@ -138,7 +147,7 @@ func TestPublisher_PublishExceptionMetric(t *testing.T) {
 
 func TestPublisher_PublishInvocationMetric(t *testing.T) {
 	type fields struct {
-		Client  cloudwatchiface.CloudWatchAPI
+		Client  CloudWatchAPI
 		resName string
 	}
 	type args struct {
@@ -154,20 +163,23 @@ func TestPublisher_PublishInvocationMetric(t *testing.T) {
 		wantAction                   string
 		wantDimensionKeyResourceType string
 		wantMetricName               string
-		wantUnit                     string
+		wantUnit                     types.StandardUnit
 		wantValue                    float64
 	}{
-		{"testPublishInvocationMetric", fields{NewMockCloudWatchClient(), "foo::bar::test"}, args{time.Now(), "CREATE"}, "HandlerInvocationCount", false, "CREATE", "foo/bar/test", "HandlerInvocationCount", cloudwatch.StandardUnitCount, 1.0},
-		{"testPublishInvocationMetricWantError", fields{NewMockCloudWatchClientError(), "foo::bar::test"}, args{time.Now(), "CREATE"}, "HandlerException", true, "CREATE", "foo/bar/test", "HandlerException", cloudwatch.StandardUnitCount, 1.0},
-		{"testPublishInvocationMetric", fields{NewMockCloudWatchClient(), "foo::bar::test"}, args{time.Now(), "UPDATE"}, "HandlerInvocationCount", false, "UPDATE", "foo/bar/test", "HandlerInvocationCount", cloudwatch.StandardUnitCount, 1.0},
-		{"testPublishInvocationMetricError", fields{NewMockCloudWatchClientError(), "foo::bar::test"}, args{time.Now(), "UPDATE"}, "HandlerException", true, "UPDATE", "foo/bar/test", "HandlerInvocationCount", cloudwatch.StandardUnitCount, 1.0},
+		{"testPublishInvocationMetric", fields{NewMockCloudWatchClient(), "foo::bar::test"}, args{time.Now(), "CREATE"}, "HandlerInvocationCount", false, "CREATE", "foo/bar/test", "HandlerInvocationCount", types.StandardUnitCount, 1.0},
+		{"testPublishInvocationMetricWantError", fields{NewMockCloudWatchClientError(), "foo::bar::test"}, args{time.Now(), "CREATE"}, "HandlerException", true, "CREATE", "foo/bar/test", "HandlerException", types.StandardUnitCount, 1.0},
+		{"testPublishInvocationMetric", fields{NewMockCloudWatchClient(), "foo::bar::test"}, args{time.Now(), "UPDATE"}, "HandlerInvocationCount", false, "UPDATE", "foo/bar/test", "HandlerInvocationCount", types.StandardUnitCount, 1.0},
+		{"testPublishInvocationMetricError", fields{NewMockCloudWatchClientError(), "foo::bar::test"}, args{time.Now(), "UPDATE"}, "HandlerException", true, "UPDATE", "foo/bar/test", "HandlerInvocationCount", types.StandardUnitCount, 1.0},
 	}
 	for i, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p := New(tt.fields.Client, tt.fields.resName)
+			p := NewV2(tt.fields.Client, tt.fields.resName)
 			t.Logf("\tTest: %d\tWhen checking %q for success", i, tt.name)
 			{
 				p.PublishInvocationMetric(tt.args.date, tt.args.action)
+				if err := p.Flush(context.Background()); (err != nil) != tt.wantErr {
+					t.Errorf("\t%s\tFlush() error = %v, wantErr %v", failed, err, tt.wantErr)
+				}
 				t.Logf("\t%s\tShould be able to make the PublishInvocationMetric call.", succeed)
 				if !tt.wantErr {
 					e := tt.fields.Client.(*MockCloudWatchClient)
@@ -211,13 +223,14 @@ func TestPublisher_PublishInvocationMetric(t *testing.T) {
 
 func TestPublisher_PublishDurationMetric(t *testing.T) {
 	type fields struct {
-		Client  cloudwatchiface.CloudWatchAPI
+		Client  CloudWatchAPI
 		resName string
 	}
 	type args struct {
-		date   time.Time
-		action string
-		sec    float64
+		date      time.Time
+		action    string
+		sec       float64
+		errorCode string
 	}
 	tests := []struct {
 		name                         string
@@ -227,21 +240,25 @@ func TestPublisher_PublishDurationMetric(t *testing.T) {
 		wantErr                      bool
 		wantAction                   string
 		wantDimensionKeyResourceType string
+		wantErrorCode                string
 		wantMetricName               string
-		wantUnit                     string
+		wantUnit                     types.StandardUnit
 		wantValue                    float64
 	}{
-		{"testPublishInvocationMetric", fields{NewMockCloudWatchClient(), "foo::bar::test"}, args{time.Now(), "CREATE", 15.0}, "HandlerInvocationDuration", false, "CREATE", "foo/bar/test", "HandlerInvocationDuration", cloudwatch.StandardUnitMilliseconds, 15},
-		{"testPublishInvocationMetricWantError", fields{NewMockCloudWatchClientError(), "foo::bar::test"}, args{time.Now(), "CREATE", 15.0}, "HandlerInvocationDuration", true, "CREATE", "foo/bar/test", "HandlerInvocationDuration", cloudwatch.StandardUnitMilliseconds, 15},
-		{"testPublishInvocationMetric", fields{NewMockCloudWatchClient(), "foo::bar::test"}, args{time.Now(), "UPDATE", 15.0}, "HandlerInvocationDuration", false, "UPDATE", "foo/bar/test", "HandlerInvocationDuration", cloudwatch.StandardUnitMilliseconds, 15},
-		{"testPublishInvocationMetricError", fields{NewMockCloudWatchClientError(), "foo::bar::test"}, args{time.Now(), "UPDATE", 15.0}, "HandlerInvocationDuration", true, "UPDATE", "foo/bar/test", "HandlerInvocationDuration", cloudwatch.StandardUnitMilliseconds, 15},
+		{"testPublishInvocationMetric", fields{NewMockCloudWatchClient(), "foo::bar::test"}, args{time.Now(), "CREATE", 15.0, ""}, "HandlerInvocationDuration", false, "CREATE", "foo/bar/test", HandlerErrorCodeNone, "HandlerInvocationDuration", types.StandardUnitMilliseconds, 15},
+		{"testPublishInvocationMetricWantError", fields{NewMockCloudWatchClientError(), "foo::bar::test"}, args{time.Now(), "CREATE", 15.0, ""}, "HandlerInvocationDuration", true, "CREATE", "foo/bar/test", HandlerErrorCodeNone, "HandlerInvocationDuration", types.StandardUnitMilliseconds, 15},
+		{"testPublishInvocationMetric", fields{NewMockCloudWatchClient(), "foo::bar::test"}, args{time.Now(), "UPDATE", 15.0, "NotFound"}, "HandlerInvocationDuration", false, "UPDATE", "foo/bar/test", "NotFound", "HandlerInvocationDuration", types.StandardUnitMilliseconds, 15},
+		{"testPublishInvocationMetricError", fields{NewMockCloudWatchClientError(), "foo::bar::test"}, args{time.Now(), "UPDATE", 15.0, "NotFound"}, "HandlerInvocationDuration", true, "UPDATE", "foo/bar/test", "NotFound", "HandlerInvocationDuration", types.StandardUnitMilliseconds, 15},
 	}
 	for i, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p := New(tt.fields.Client, tt.fields.resName)
+			p := NewV2(tt.fields.Client, tt.fields.resName)
 			t.Logf("\tTest: %d\tWhen checking %q for success", i, tt.name)
 			{
-				p.PublishDurationMetric(tt.args.date, tt.args.action, tt.args.sec)
+				p.PublishDurationMetric(tt.args.date, tt.args.action, tt.args.sec, tt.args.errorCode)
+				if err := p.Flush(context.Background()); (err != nil) != tt.wantErr {
+					t.Errorf("\t%s\tFlush() error = %v, wantErr %v", failed, err, tt.wantErr)
+				}
 				t.Logf("\t%s\tShould be able to make the PublishDurationMetric call.", succeed)
 				if !tt.wantErr {
 					e := tt.fields.Client.(*MockCloudWatchClient)
@@ -258,6 +275,12 @@ func TestPublisher_PublishDurationMetric(t *testing.T) {
 						t.Errorf("\t%s\tDimensionKeyResourceType should be (%v). : %v", failed, tt.wantDimensionKeyResourceType, e.Dim[DimensionKeyResourceType])
 					}
 
+					if e.Dim[DimensionKeyHandlerErrorCode] == tt.wantErrorCode {
+						t.Logf("\t%s\t DimensionKeyHandlerErrorCode should be (%v).", succeed, tt.wantErrorCode)
+					} else {
+						t.Errorf("\t%s\tDimensionKeyHandlerErrorCode should be (%v). : %v", failed, tt.wantErrorCode, e.Dim[DimensionKeyHandlerErrorCode])
+					}
+
 					if e.MetricName == tt.wantMetricName {
 						t.Logf("\t%s\t MetricName should be (%v).", succeed, tt.wantMetricName)
 					} else {
@@ -306,3 +329,190 @@ func TestPublisher_ResourceTypeName(t *testing.T) {
 		})
 	}
 }
+
+func TestPublisher_SetCorrelationID(t *testing.T) {
+	client := NewMockCloudWatchClient()
+	p := NewV2(client, "foo::bar::test")
+	p.SetCorrelationID("123456-2")
+
+	p.PublishExceptionMetric(time.Now(), "CREATE", errors.New("failed to create resource"))
+	if err := p.Flush(context.Background()); err != nil {
+		t.Fatalf("Error returned: %v", err)
+	}
+	// a dimension unique to each invocation would create a metric per failure
+	if _, ok := client.Dim["CorrelationId"]; ok || len(client.Dim) != 3 {
+		t.Errorf("Exception metric dimensions = %v; want no CorrelationId", client.Dim)
+	}
+}
+
+// MockCloudWatchV1Client records the PutMetricData calls of an AWS SDK for Go v1 client.
+type MockCloudWatchV1Client struct {
+	cloudwatchiface.CloudWatchAPI
+	Calls []*cloudwatchv1.PutMetricDataInput
+}
+
+func (m *MockCloudWatchV1Client) PutMetricData(in *cloudwatchv1.PutMetricDataInput) (*cloudwatchv1.PutMetricDataOutput, error) {
+	m.Calls = append(m.Calls, in)
+	return nil, nil
+}
+
+func TestNew(t *testing.T) {
+	client := &MockCloudWatchV1Client{}
+	p := New(client, "foo::bar::test")
+
+	now := time.Now()
+	p.PublishDurationMetric(now, "CREATE", 10, "")
+	p.PublishDurationMetric(now, "CREATE", 20, "")
+	p.PublishInvocationMetric(now, "CREATE")
+	if err := p.Flush(context.Background()); err != nil {
+		t.Fatalf("Error returned: %v", err)
+	}
+
+	if len(client.Calls) != 1 || len(client.Calls[0].MetricData) != 2 {
+		t.Fatalf("Calls = %v; want one with two datums", client.Calls)
+	}
+	in := client.Calls[0]
+	if aws.StringValue(in.Namespace) != "AWS/CloudFormation/foo/bar/test" {
+		t.Errorf("Namespace = %v", aws.StringValue(in.Namespace))
+	}
+	for _, d := range in.MetricData {
+		switch aws.StringValue(d.MetricName) {
+		case MetricNameHanderDuration:
+			if s := d.StatisticValues; s == nil || aws.Float64Value(s.SampleCount) != 2 || aws.Float64Value(s.Sum) != 30 || aws.StringValue(d.Unit) != "Milliseconds" {
+				t.Errorf("Duration datum = %v", d)
+			}
+		case MetricNameHanderInvocationCount:
+			if aws.Float64Value(d.Value) != 1 || len(d.Dimensions) != 2 || aws.StringValue(d.Unit) != "Count" {
+				t.Errorf("Invocation datum = %v", d)
+			}
+		default:
+			t.Errorf("Unexpected datum %v", d)
+		}
+	}
+}
+
+// RecordingCloudWatchClient records every PutMetricData call.
+type RecordingCloudWatchClient struct {
+	Calls []*cloudwatch.PutMetricDataInput
+}
+
+func (m *RecordingCloudWatchClient) PutMetricData(ctx context.Context, in *cloudwatch.PutMetricDataInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricDataOutput, error) {
+	m.Calls = append(m.Calls, in)
+	return nil, nil
+}
+
+func TestPublisher_Flush(t *testing.T) {
+	t.Run("Aggregate", func(t *testing.T) {
+		client := &RecordingCloudWatchClient{}
+		p := NewV2(client, "foo::bar::test")
+
+		now := time.Now()
+		p.PublishInvocationMetric(now, "CREATE")
+		p.PublishDurationMetric(now, "CREATE", 10, "")
+		p.PublishDurationMetric(now, "CREATE", 30, "")
+		p.PublishDurationMetric(now, "CREATE", 20, "")
+		p.PublishDurationMetric(now, "UPDATE", 5, "")
+
+		if len(client.Calls) != 0 {
+			t.Fatalf("Metrics sent before Flush")
+		}
+		if err := p.Flush(context.Background()); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+
+		if len(client.Calls) != 1 {
+			t.Fatalf("Expected a single call, got %d", len(client.Calls))
+		}
+		data := client.Calls[0].MetricData
+		if len(data) != 3 {
+			t.Fatalf("Expected 3 datums, got %d", len(data))
+		}
+
+		if data[0].Value == nil || *data[0].Value != 1 {
+			t.Errorf("Invocation datum = %+v; want a single value", data[0])
+		}
+
+		s := data[1].StatisticValues
+		if s == nil || *s.SampleCount != 3 || *s.Sum != 60 || *s.Minimum != 10 || *s.Maximum != 30 || data[1].Value != nil {
+			t.Errorf("Duration datum = %+v; want a statistic set", data[1])
+		}
+
+		if err := p.Flush(context.Background()); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+		if len(client.Calls) != 1 {
+			t.Fatalf("Metrics sent twice")
+		}
+	})
+
+	t.Run("Chunks", func(t *testing.T) {
+		client := &RecordingCloudWatchClient{}
+		p := NewV2(client, "foo::bar::test")
+
+		for i := 0; i < maxDatumsPerCall+1; i++ {
+			p.PublishExceptionMetric(time.Now(), "CREATE", cfnerr.New(fmt.Sprintf("Code%d", i), "failed", nil))
+		}
+		if err := p.Flush(context.Background()); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+
+		if len(client.Calls) != 2 || len(client.Calls[0].MetricData) != maxDatumsPerCall || len(client.Calls[1].MetricData) != 1 {
+			t.Fatalf("Unexpected calls: %d", len(client.Calls))
+		}
+	})
+}
+
+func TestPublisher_PublishOperationMetrics(t *testing.T) {
+	sink := NewMemorySink()
+	p := NewWithSink(sink, "foo::bar::test")
+
+	p.PublishOperationMetrics(time.Now(), "CREATE", "SUCCESS", 40, 10*time.Minute)
+	if err := p.Flush(context.Background()); err != nil {
+		t.Fatalf("Error returned: %v", err)
+	}
+
+	success := map[string]string{
+		DimensionKeyAcionType:       "CREATE",
+		DimensionKeyOperationStatus: "SUCCESS",
+		DimensionKeyResourceType:    "foo/bar/test",
+	}
+	if n := sink.Sum(MetricNameOperationStatus, success); n != 1 {
+		t.Errorf("OperationStatus = %v; want 1", n)
+	}
+	if n := sink.Sum(MetricNameOperationAttempts, success); n != 40 {
+		t.Errorf("OperationAttempts = %v; want 40", n)
+	}
+	if d := sink.Sum(MetricNameOperationDuration, success); d != 600000 {
+		t.Errorf("OperationDuration = %v; want 600000", d)
+	}
+}
+
+func TestPublishExceptionMetric_Dimensions(t *testing.T) {
+	want := []string{DimensionKeyAcionType, DimensionKeyExceptionType, DimensionKeyResourceType}
+
+	memory := NewMemorySink()
+	var emf bytes.Buffer
+	for name, s := range map[string]Sink{"Memory": memory, "EMF": NewEMFSink(&emf)} {
+		p := NewWithSink(s, "foo::bar::test")
+		p.SetCorrelationID("123456-1")
+		p.PublishExceptionMetric(time.Now(), "CREATE", cfnerr.New("NotFound", "gone", nil))
+		if err := p.Flush(context.Background()); err != nil {
+			t.Fatalf("%s: Error returned: %v", name, err)
+		}
+	}
+
+	m := memory.Find(MetricNameHanderException, nil)
+	if len(m) != 1 || strings.Join(m[0].dimensionNames(), ",") != strings.Join(want, ",") {
+		t.Errorf("Memory dimensions = %v; want %v", m, want)
+	}
+
+	var record struct {
+		AWS emfDirective `json:"_aws"`
+	}
+	if err := json.Unmarshal(emf.Bytes(), &record); err != nil {
+		t.Fatalf("Invalid record: %v", err)
+	}
+	if got := record.AWS.CloudWatchMetrics[0].Dimensions[0]; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("EMF dimensions = %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// recorderKey is used to store a Recorder in a context.
+type recorderKey struct{}
+
+// defaultRecorder is the Recorder of the current invocation.
+var defaultRecorder atomic.Pointer[Recorder]
+
+// A Recorder publishes custom metrics from a handler.
+//
+// Custom metrics go into the namespace of the resource type with the Action
+// and ResourceType dimensions, and are sent in the same batch as the metrics
+// of the runtime. A nil Recorder discards everything recorded with it.
+//
+//	m := request.Metrics()
+//	m.Count("StabilizationPolls", 1)
+//	m.Timing("UpstreamLatency", time.Since(start))
+type Recorder struct {
+	p      *Publisher
+	action string
+}
+
+// Recorder returns a Recorder publishing custom metrics for an action.
+func (p *Publisher) Recorder(action string) *Recorder {
+	return &Recorder{p: p, action: action}
+}
+
+// Count adds n to a counter.
+func (r *Recorder) Count(name string, n float64) {
+	r.record(name, types.StandardUnitCount, n)
+}
+
+// Gauge records the value of a gauge, such as a queue depth or a size in bytes.
+func (r *Recorder) Gauge(name string, value float64, unit types.StandardUnit) {
+	if len(unit) == 0 {
+		unit = types.StandardUnitNone
+	}
+	r.record(name, unit, value)
+}
+
+// Timing records a duration in milliseconds.
+func (r *Recorder) Timing(name string, d time.Duration) {
+	r.record(name, types.StandardUnitMilliseconds, float64(d)/float64(time.Millisecond))
+}
+
+func (r *Recorder) record(name string, unit types.StandardUnit, value float64) {
+	if r == nil || r.p == nil || len(name) == 0 {
+		return
+	}
+
+	dimensions := map[string]string{
+		DimensionKeyAcionType:    r.action,
+		DimensionKeyResourceType: r.p.resourceType,
+	}
+	r.p.publishMetric(name, dimensions, unit, value, time.Now())
+}
+
+// SetDefault makes r the Recorder returned by Default.
+//
+// The runtime sets it at the start of each invocation.
+func SetDefault(r *Recorder) {
+	defaultRecorder.Store(r)
+}
+
+// Default returns the Recorder of the current invocation, or nil outside of one.
+func Default() *Recorder {
+	return defaultRecorder.Load()
+}
+
+// NewContext returns a copy of ctx carrying the Recorder.
+func NewContext(ctx context.Context, r *Recorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, r)
+}
+
+// FromContext returns the Recorder carried by ctx, or the default Recorder.
+func FromContext(ctx context.Context) *Recorder {
+	if r, ok := ctx.Value(recorderKey{}).(*Recorder); ok {
+		return r
+	}
+
+	return Default()
+}
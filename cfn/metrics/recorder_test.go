@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+func TestRecorder(t *testing.T) {
+	client := &RecordingCloudWatchClient{}
+	p := NewV2(client, "foo::bar::test")
+	r := p.Recorder("CREATE")
+
+	p.PublishInvocationMetric(time.Now(), "CREATE")
+	r.Count("StabilizationPolls", 1)
+	r.Count("StabilizationPolls", 2)
+	r.Gauge("QueueDepth", 7, "")
+	r.Timing("UpstreamLatency", 1500*time.Microsecond)
+	r.Count("", 1)
+
+	if err := p.Flush(context.Background()); err != nil {
+		t.Fatalf("Error returned: %v", err)
+	}
+	if len(client.Calls) != 1 {
+		t.Fatalf("Expected a single call, got %d", len(client.Calls))
+	}
+	if ns := aws.ToString(client.Calls[0].Namespace); ns != "AWS/CloudFormation/foo/bar/test" {
+		t.Errorf("Namespace = %s", ns)
+	}
+
+	data := client.Calls[0].MetricData
+	if len(data) != 4 {
+		t.Fatalf("Expected 4 datums, got %d", len(data))
+	}
+
+	tests := []struct {
+		name string
+		unit types.StandardUnit
+	}{
+		{MetricNameHanderInvocationCount, types.StandardUnitCount},
+		{"StabilizationPolls", types.StandardUnitCount},
+		{"QueueDepth", types.StandardUnitNone},
+		{"UpstreamLatency", types.StandardUnitMilliseconds},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := data[i]
+			if aws.ToString(d.MetricName) != tt.name || d.Unit != tt.unit {
+				t.Errorf("Datum = %s %s; want %s %s", aws.ToString(d.MetricName), d.Unit, tt.name, tt.unit)
+			}
+
+			dims := map[string]string{}
+			for _, v := range d.Dimensions {
+				dims[aws.ToString(v.Name)] = aws.ToString(v.Value)
+			}
+			if dims[DimensionKeyAcionType] != "CREATE" || dims[DimensionKeyResourceType] != "foo/bar/test" {
+				t.Errorf("Dimensions = %v", dims)
+			}
+		})
+	}
+
+	if s := data[1].StatisticValues; s == nil || *s.Sum != 3 {
+		t.Errorf("Counter = %+v; want a sum of 3", data[1])
+	}
+	if v := data[3].Value; v == nil || *v != 1.5 {
+		t.Errorf("Timing = %+v; want 1.5", data[3])
+	}
+}
+
+func TestRecorder_Nil(t *testing.T) {
+	var r *Recorder
+	r.Count("StabilizationPolls", 1)
+	r.Gauge("QueueDepth", 1, types.StandardUnitCount)
+	r.Timing("UpstreamLatency", time.Second)
+}
+
+func TestFromContext(t *testing.T) {
+	r := NewV2(NewMockCloudWatchClient(), "foo::bar::test").Recorder("CREATE")
+	d := NewV2(NewMockCloudWatchClient(), "foo::bar::test").Recorder("UPDATE")
+
+	SetDefault(d)
+	defer SetDefault(nil)
+
+	if got := FromContext(context.Background()); got != d {
+		t.Errorf("FromContext() = %v; want the default recorder", got)
+	}
+	if got := FromContext(NewContext(context.Background(), r)); got != r {
+		t.Errorf("FromContext() = %v; want the context recorder", got)
+	}
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/aws"
+	cloudwatchv1 "github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+)
+
+// cloudWatchV1 adapts an AWS SDK for Go v1 client to CloudWatchAPI.
+//
+// It calls the same methods as the Publisher used to, so clients mocking only
+// those keep working.
+type cloudWatchV1 struct {
+	client cloudwatchiface.CloudWatchAPI
+}
+
+// PutMetricData sends the metrics with the v1 client.
+func (c cloudWatchV1) PutMetricData(ctx context.Context, params *cloudwatch.PutMetricDataInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricDataOutput, error) {
+	in := &cloudwatchv1.PutMetricDataInput{
+		Namespace: params.Namespace,
+	}
+	for _, d := range params.MetricData {
+		datum := &cloudwatchv1.MetricDatum{
+			MetricName: d.MetricName,
+			Timestamp:  d.Timestamp,
+			Value:      d.Value,
+			Values:     aws.Float64Slice(d.Values),
+			Counts:     aws.Float64Slice(d.Counts),
+		}
+		if len(d.Unit) != 0 {
+			datum.Unit = aws.String(string(d.Unit))
+		}
+		if d.StorageResolution != nil {
+			datum.StorageResolution = aws.Int64(int64(*d.StorageResolution))
+		}
+		for _, dim := range d.Dimensions {
+			datum.Dimensions = append(datum.Dimensions, &cloudwatchv1.Dimension{
+				Name:  dim.Name,
+				Value: dim.Value,
+			})
+		}
+		if s := d.StatisticValues; s != nil {
+			datum.StatisticValues = &cloudwatchv1.StatisticSet{
+				SampleCount: s.SampleCount,
+				Sum:         s.Sum,
+				Minimum:     s.Minimum,
+				Maximum:     s.Maximum,
+			}
+		}
+		in.MetricData = append(in.MetricData, datum)
+	}
+
+	if _, err := c.client.PutMetricData(in); err != nil {
+		return nil, err
+	}
+
+	return &cloudwatch.PutMetricDataOutput{}, nil
+}
@@ -0,0 +1,217 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// Format selects how a Publisher sends metrics.
+type Format string
+
+const (
+	// FormatAPI sends metrics with the CloudWatch PutMetricData API.
+	FormatAPI Format = "api"
+
+	// FormatEMF writes metrics as CloudWatch Embedded Metric Format log records.
+	FormatEMF Format = "emf"
+
+	// FormatText writes metrics as text lines to stdout, for local runs.
+	FormatText Format = "text"
+
+	// FormatPrometheus writes the totals of the metrics to a file in the
+	// Prometheus text format, see NewPrometheusSink.
+	FormatPrometheus Format = "prometheus"
+
+	// FormatEnv is the environment variable selecting the Format, "api", "emf",
+	// "text" or "prometheus".
+	FormatEnv = "CFN_METRICS_FORMAT"
+
+	// PrometheusPathEnv is the environment variable holding the path of the
+	// file written with FormatPrometheus.
+	PrometheusPathEnv = "CFN_METRICS_PROMETHEUS_PATH"
+
+	// DefaultPrometheusPath is the file written with FormatPrometheus when
+	// CFN_METRICS_PROMETHEUS_PATH isn't set; /tmp is writable in Lambda.
+	DefaultPrometheusPath = "/tmp/cfn.prom"
+)
+
+// samLocalEnv is set when the provider runs in SAM CLI.
+const samLocalEnv = "AWS_SAM_LOCAL"
+
+// FormatFromEnv reads the Format from CFN_METRICS_FORMAT, defaulting to FormatAPI,
+// or to FormatText in SAM CLI.
+func FormatFromEnv() Format {
+	switch f := Format(strings.ToLower(os.Getenv(FormatEnv))); f {
+	case FormatAPI, FormatEMF, FormatText, FormatPrometheus:
+		return f
+	}
+
+	if len(os.Getenv(samLocalEnv)) != 0 {
+		return FormatText
+	}
+
+	return FormatAPI
+}
+
+// PrometheusPathFromEnv reads the path of the Prometheus file from
+// CFN_METRICS_PROMETHEUS_PATH, defaulting to DefaultPrometheusPath.
+func PrometheusPathFromEnv() string {
+	if p := os.Getenv(PrometheusPathEnv); len(p) != 0 {
+		return p
+	}
+
+	return DefaultPrometheusPath
+}
+
+// A Sink receives the metrics of a Publisher each time it's flushed.
+//
+// The runtime sends metrics to CloudWatch; other sinks let tests assert on the
+// metrics of a handler, or let them be inspected during local runs.
+type Sink interface {
+	Write(ctx context.Context, b Batch) error
+}
+
+// A Batch holds the metrics aggregated by a Publisher between two flushes.
+type Batch struct {
+	// Namespace is the CloudWatch namespace of the resource type.
+	Namespace string
+
+	// CorrelationID is the ID of the invocation the metrics were published in.
+	CorrelationID string
+
+	// Metrics are in the order they were first published.
+	Metrics []Metric
+}
+
+// A Metric holds the values published for a metric name, unit and set of dimensions.
+type Metric struct {
+	Name       string
+	Unit       types.StandardUnit
+	Dimensions map[string]string
+	Timestamp  time.Time
+	Values     []float64
+}
+
+// Count returns the number of values.
+func (m Metric) Count() int {
+	return len(m.Values)
+}
+
+// Sum returns the sum of the values.
+func (m Metric) Sum() float64 {
+	var sum float64
+	for _, v := range m.Values {
+		sum += v
+	}
+
+	return sum
+}
+
+// Min returns the smallest value.
+func (m Metric) Min() float64 {
+	var min float64
+	for i, v := range m.Values {
+		if i == 0 || v < min {
+			min = v
+		}
+	}
+
+	return min
+}
+
+// Max returns the largest value.
+func (m Metric) Max() float64 {
+	var max float64
+	for i, v := range m.Values {
+		if i == 0 || v > max {
+			max = v
+		}
+	}
+
+	return max
+}
+
+// dimensionNames returns the sorted names of the dimensions.
+func (m Metric) dimensionNames() []string {
+	names := make([]string, 0, len(m.Dimensions))
+	for k := range m.Dimensions {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// cloudWatchSink sends metrics with the PutMetricData API.
+type cloudWatchSink struct {
+	client CloudWatchAPI
+}
+
+// NewCloudWatchSink creates a Sink sending metrics to CloudWatch in as few
+// PutMetricData calls as possible.
+func NewCloudWatchSink(client CloudWatchAPI) Sink {
+	return &cloudWatchSink{client: client}
+}
+
+// Write sends the metrics, using a statistic set for the metrics with more than one value.
+func (s *cloudWatchSink) Write(ctx context.Context, b Batch) error {
+	data := make([]types.MetricDatum, 0, len(b.Metrics))
+	for _, m := range b.Metrics {
+		data = append(data, datum(m))
+	}
+
+	var errs []error
+	for len(data) != 0 {
+		n := len(data)
+		if n > maxDatumsPerCall {
+			n = maxDatumsPerCall
+		}
+
+		if _, err := s.client.PutMetricData(ctx, &cloudwatch.PutMetricDataInput{
+			Namespace:  aws.String(b.Namespace),
+			MetricData: data[:n],
+		}); err != nil {
+			errs = append(errs, err)
+		}
+		data = data[n:]
+	}
+
+	return errors.Join(errs...)
+}
+
+// datum returns the metric as a metric datum.
+func datum(m Metric) types.MetricDatum {
+	d := types.MetricDatum{
+		MetricName: aws.String(m.Name),
+		Unit:       m.Unit,
+		Timestamp:  aws.Time(m.Timestamp),
+	}
+	for _, k := range m.dimensionNames() {
+		d.Dimensions = append(d.Dimensions, types.Dimension{
+			Name:  aws.String(k),
+			Value: aws.String(m.Dimensions[k]),
+		})
+	}
+
+	if m.Count() == 1 {
+		d.Value = aws.Float64(m.Values[0])
+		return d
+	}
+
+	d.StatisticValues = &types.StatisticSet{
+		SampleCount: aws.Float64(float64(m.Count())),
+		Sum:         aws.Float64(m.Sum()),
+		Minimum:     aws.Float64(m.Min()),
+		Maximum:     aws.Float64(m.Max()),
+	}
+
+	return d
+}
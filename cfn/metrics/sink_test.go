@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+func TestFormatFromEnv(t *testing.T) {
+	tests := []struct {
+		value    string
+		samLocal string
+		want     Format
+	}{
+		{"", "", FormatAPI},
+		{"api", "", FormatAPI},
+		{"EMF", "", FormatEMF},
+		{"text", "", FormatText},
+		{"Prometheus", "", FormatPrometheus},
+		{"other", "", FormatAPI},
+		{"", "true", FormatText},
+		{"emf", "true", FormatEMF},
+		{"api", "true", FormatAPI},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value+"/"+tt.samLocal, func(t *testing.T) {
+			t.Setenv(FormatEnv, tt.value)
+			t.Setenv(samLocalEnv, tt.samLocal)
+
+			if got := FormatFromEnv(); got != tt.want {
+				t.Errorf("FormatFromEnv() = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrometheusPathFromEnv(t *testing.T) {
+	t.Setenv(PrometheusPathEnv, "")
+	if got := PrometheusPathFromEnv(); got != DefaultPrometheusPath {
+		t.Errorf("PrometheusPathFromEnv() = %q; want %q", got, DefaultPrometheusPath)
+	}
+
+	t.Setenv(PrometheusPathEnv, "/var/lib/node_exporter/cfn.prom")
+	if got := PrometheusPathFromEnv(); got != "/var/lib/node_exporter/cfn.prom" {
+		t.Errorf("PrometheusPathFromEnv() = %q", got)
+	}
+}
+
+func TestMetric(t *testing.T) {
+	m := Metric{Values: []float64{20, 10, 30}}
+	if m.Count() != 3 || m.Sum() != 60 || m.Min() != 10 || m.Max() != 30 {
+		t.Errorf("Statistics = %d %v %v %v", m.Count(), m.Sum(), m.Min(), m.Max())
+	}
+}
+
+func TestMemorySink(t *testing.T) {
+	sink := NewMemorySink()
+	p := NewWithSink(sink, "foo::bar::test")
+	p.SetCorrelationID("123456-1")
+
+	now := time.Now()
+	p.PublishInvocationMetric(now, "CREATE")
+	p.PublishInvocationMetric(now, "UPDATE")
+	p.PublishDurationMetric(now, "CREATE", 10, "")
+	p.PublishDurationMetric(now, "CREATE", 30, "")
+	p.PublishExceptionMetric(now, "CREATE", errors.New("failed to create resource"))
+	if err := p.Flush(context.Background()); err != nil {
+		t.Fatalf("Error returned: %v", err)
+	}
+
+	if len(sink.Metrics()) != 4 {
+		t.Fatalf("Expected 4 metrics, got %d", len(sink.Metrics()))
+	}
+	if n := sink.Count(MetricNameHanderInvocationCount, nil); n != 2 {
+		t.Errorf("Invocations = %d; want 2", n)
+	}
+	if n := sink.Count(MetricNameHanderInvocationCount, map[string]string{DimensionKeyAcionType: "UPDATE"}); n != 1 {
+		t.Errorf("UPDATE invocations = %d; want 1", n)
+	}
+	if sum := sink.Sum(MetricNameHanderDuration, map[string]string{DimensionKeyAcionType: "CREATE"}); sum != 40 {
+		t.Errorf("CREATE duration = %v; want 40", sum)
+	}
+	if m := sink.Find(MetricNameHanderException, nil); len(m) != 1 || len(m[0].Dimensions) != 3 {
+		t.Errorf("Exceptions = %v; want one without the correlation ID", m)
+	}
+	if b := sink.Batches(); len(b) != 1 || b[0].Namespace != "AWS/CloudFormation/foo/bar/test" || b[0].CorrelationID != "123456-1" {
+		t.Errorf("Batches = %+v", b)
+	}
+
+	sink.Reset()
+	if len(sink.Metrics()) != 0 {
+		t.Errorf("Metrics kept after Reset")
+	}
+}
+
+func TestTextSink(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewWithSink(NewTextSink(&buf), "foo::bar::test")
+	p.SetCorrelationID("123456-1")
+
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	p.PublishDurationMetric(now, "CREATE", 20, "")
+	p.PublishDurationMetric(now, "CREATE", 10, "")
+	if err := p.Flush(context.Background()); err != nil {
+		t.Fatalf("Error returned: %v", err)
+	}
+
+	want := "2024-01-02T15:04:05Z AWS/CloudFormation/foo/bar/test HandlerInvocationDuration{Action=CREATE,HandlerErrorCode=None,ResourceType=foo/bar/test} count=2 sum=30 min=10 max=20 unit=Milliseconds correlationId=123456-1\n"
+	if buf.String() != want {
+		t.Errorf("Output = %q; want %q", buf.String(), want)
+	}
+}
+
+func TestPrometheusSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cfn.prom")
+	p := NewWithSink(NewPrometheusSink(path), "foo::bar::test")
+
+	for i := 0; i < 2; i++ {
+		p.PublishInvocationMetric(time.Now(), "CREATE")
+		p.PublishDurationMetric(time.Now(), "CREATE", 10, "")
+		p.Recorder("CREATE").Gauge("QueueDepth", 3, types.StandardUnitNone)
+		if err := p.Flush(context.Background()); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unable to read the file: %v", err)
+	}
+
+	want := strings.Join([]string{
+		`# TYPE cfn_handler_invocation_count_total counter`,
+		`cfn_handler_invocation_count_total{action="CREATE",resource_type="foo/bar/test"} 2`,
+		`# TYPE cfn_handler_invocation_duration_milliseconds summary`,
+		`cfn_handler_invocation_duration_milliseconds_sum{action="CREATE",handler_error_code="None",resource_type="foo/bar/test"} 20`,
+		`cfn_handler_invocation_duration_milliseconds_count{action="CREATE",handler_error_code="None",resource_type="foo/bar/test"} 2`,
+		`# TYPE cfn_queue_depth summary`,
+		`cfn_queue_depth_sum{action="CREATE",resource_type="foo/bar/test"} 6`,
+		`cfn_queue_depth_count{action="CREATE",resource_type="foo/bar/test"} 2`,
+	}, "\n") + "\n"
+	if string(b) != want {
+		t.Errorf("File = %s; want %s", b, want)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil || len(entries) != 1 {
+		t.Errorf("Temporary files left behind: %v", entries)
+	}
+}
+
+func TestPromName(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"HandlerInvocationCount", "handler_invocation_count"},
+		{"Bytes/Second", "bytes_second"},
+		{"upstream latency", "upstream_latency"},
+		{"ResourceType", "resource_type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := promName(tt.in); got != tt.want {
+				t.Errorf("promName(%q) = %q; want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// textSink writes metrics as human readable lines.
+type textSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewTextSink creates a Sink writing one line per metric to w, for local runs:
+//
+//	2024-01-02T15:04:05Z AWS/CloudFormation/Org/Service/Resource HandlerInvocationDuration{Action=CREATE,ResourceType=Org/Service/Resource} count=2 sum=30 min=10 max=20 unit=Milliseconds
+func NewTextSink(w io.Writer) Sink {
+	return &textSink{w: w}
+}
+
+// Write writes the metrics.
+func (s *textSink) Write(ctx context.Context, b Batch) error {
+	var out strings.Builder
+	for _, m := range b.Metrics {
+		dims := make([]string, 0, len(m.Dimensions))
+		for _, k := range m.dimensionNames() {
+			dims = append(dims, k+"="+m.Dimensions[k])
+		}
+
+		fmt.Fprintf(&out, "%s %s %s{%s} count=%d sum=%g min=%g max=%g unit=%s",
+			m.Timestamp.UTC().Format(time.RFC3339), b.Namespace, m.Name, strings.Join(dims, ","),
+			m.Count(), m.Sum(), m.Min(), m.Max(), m.Unit)
+		if len(b.CorrelationID) != 0 {
+			fmt.Fprintf(&out, " correlationId=%s", b.CorrelationID)
+		}
+		out.WriteString("\n")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := io.WriteString(s.w, out.String())
+
+	return err
+}
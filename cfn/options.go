@@ -0,0 +1,301 @@
+package cfn
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/audit"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/credentials"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/logging"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/metrics"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/profiling"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/scheduler"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/tracing"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/aws/session"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// defaultMetricsFlushTimeout bounds the time spent sending metrics at the end of an invocation.
+const defaultMetricsFlushTimeout = 2 * time.Second
+
+// traceFlushTimeout bounds the time spent exporting spans at the end of an invocation.
+const traceFlushTimeout = 2 * time.Second
+
+// Option configures the runtime started by Start.
+type Option func(*options)
+
+// options holds the runtime configuration shared by every invocation.
+type options struct {
+	endpoints      credentials.Endpoints
+	providerLogs   bool
+	logDestination logging.Destination
+	logLevel       slog.Level
+	schema         *logging.SchemaRedactor
+
+	permissions     map[string][]string
+	permissionCheck bool
+
+	metricsFormat       metrics.Format
+	metricsSink         metrics.Sink
+	metricsFlushTimeout time.Duration
+	prometheusPath      string
+	// prometheusSink keeps the totals of the metrics between invocations
+	prometheusSink metrics.Sink
+
+	traceExporter sdktrace.SpanExporter
+
+	profiler *profiling.Profiler
+
+	localCallbackDelay time.Duration
+}
+
+// newOptions returns the runtime configuration read from the
+// environment with the supplied options applied on top.
+func newOptions(opts ...Option) *options {
+	o := &options{
+		endpoints:    credentials.EndpointsFromEnv(),
+		providerLogs: logging.ProviderLogsEnabled(),
+		logLevel:     logging.LevelFromEnv(),
+
+		permissionCheck: audit.PermissionCheckEnabled(),
+
+		metricsFormat:       metrics.FormatFromEnv(),
+		metricsFlushTimeout: defaultMetricsFlushTimeout,
+		prometheusPath:      metrics.PrometheusPathFromEnv(),
+	}
+
+	exp, err := tracing.ExporterFromEnv(context.Background())
+	if err != nil {
+		log.Printf("Tracing is off: %v", err)
+	}
+	o.traceExporter = exp
+
+	prof, err := profiling.FromEnv()
+	if err != nil {
+		log.Printf("Profiling is off: %v", err)
+	}
+	o.profiler = prof
+
+	delay, err := scheduler.LocalDelayFromEnv()
+	if err != nil {
+		log.Printf("Local callbacks are off: %v", err)
+	}
+	o.localCallbackDelay = delay
+
+	d, err := logging.DestinationFromEnv()
+	if err != nil {
+		log.Printf("Ignoring the provider log destination: %v", err)
+	} else {
+		o.logDestination = d
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// WithEndpoints overrides the AWS endpoints used by every session the runtime
+// creates, including the caller session passed to handlers.
+//
+// It replaces any endpoints read from CFN_ENDPOINT_URL and CFN_ENDPOINT_URLS.
+func WithEndpoints(e credentials.Endpoints) Option {
+	return func(o *options) {
+		o.endpoints = e
+	}
+}
+
+// WithProviderLogs turns shipping provider logs to CloudWatch Logs on or off,
+// replacing the setting read from CFN_PROVIDER_LOGS.
+//
+// When off, provider logs are written to stderr.
+func WithProviderLogs(enabled bool) Option {
+	return func(o *options) {
+		o.providerLogs = enabled
+	}
+}
+
+// WithProviderLogDestination sets the log stream naming, and the retention and KMS key
+// of the log groups created for provider logs.
+//
+// It replaces any destination read from CFN_LOG_STREAM_TEMPLATE,
+// CFN_LOG_RETENTION_DAYS and CFN_LOG_KMS_KEY_ID.
+func WithProviderLogDestination(d logging.Destination) Option {
+	return func(o *options) {
+		o.logDestination = d
+	}
+}
+
+// WithLogLevel sets the level of the structured logger, replacing the level read
+// from CFN_LOG_LEVEL.
+//
+// A LogLevel property in the type configuration takes precedence.
+func WithLogLevel(l slog.Level) Option {
+	return func(o *options) {
+		o.logLevel = l
+	}
+}
+
+// WithSchema masks the writeOnlyProperties of the resource schema, and the properties
+// marked sensitive, in models written to the logs, including the progress logged or
+// written to CFN_CALLBACK_FILE instead of being reported.
+//
+// Providers generated by cfn generate embed their schema and pass it.
+//
+// sensitive lists extra properties to mask as JSON pointers, see logging.NewSchemaRedactor.
+// An invalid schema is logged and ignored.
+//
+// The handler permissions of the schema are used by the permission check, see
+// WithPermissionCheck.
+func WithSchema(schema []byte, sensitive ...string) Option {
+	return func(o *options) {
+		r, err := logging.NewSchemaRedactor(schema, sensitive...)
+		if err != nil {
+			log.Printf("Ignoring the resource schema: %v", err)
+			return
+		}
+		o.schema = r
+
+		p, err := audit.SchemaPermissions(schema)
+		if err != nil {
+			log.Printf("Ignoring the resource schema: %v", err)
+			return
+		}
+		o.permissions = p
+	}
+}
+
+// WithPermissionCheck compares the IAM actions implied by the AWS API calls of
+// each invocation with the permissions the resource schema declares for the
+// action, logging the missing and unused ones, see audit.CheckPermissions.
+// It replaces the setting read from CFN_PERMISSION_CHECK.
+//
+// The schema is set with WithSchema, which providers generated by cfn generate
+// do; without it, the check is skipped.
+func WithPermissionCheck(enabled bool) Option {
+	return func(o *options) {
+		o.permissionCheck = enabled
+	}
+}
+
+// WithMetricsFormat selects how metrics are sent, replacing the format read from
+// CFN_METRICS_FORMAT.
+//
+// With metrics.FormatEMF, metrics are written to the provider logs as Embedded Metric
+// Format records and the provider role no longer needs cloudwatch:PutMetricData.
+// With metrics.FormatPrometheus, their totals are written to the file named by
+// CFN_METRICS_PROMETHEUS_PATH.
+func WithMetricsFormat(f metrics.Format) Option {
+	return func(o *options) {
+		o.metricsFormat = f
+	}
+}
+
+// WithMetricsSink sends metrics to s instead of the destination selected by
+// the metrics format, for example a metrics.MemorySink to assert on the metrics
+// of a handler in tests, or a Prometheus file during local runs.
+func WithMetricsSink(s metrics.Sink) Option {
+	return func(o *options) {
+		o.metricsSink = s
+	}
+}
+
+// WithMetricsFlushTimeout bounds the time spent sending the metrics of an
+// invocation before its response is returned. The default is 2 seconds.
+func WithMetricsFlushTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.metricsFlushTimeout = d
+	}
+}
+
+// WithTracing traces each invocation with OpenTelemetry, exporting spans with exp,
+// instead of the exporter selected by CFN_TRACING_EXPORTER.
+//
+// Exporters are created with tracing.NewStdoutExporter, tracing.NewOTLPExporter
+// or, in tests, tracingtest.NewMemoryExporter; a nil exporter turns tracing off.
+func WithTracing(exp sdktrace.SpanExporter) Option {
+	return func(o *options) {
+		o.traceExporter = exp
+	}
+}
+
+// WithProfiling samples the CPU during each invocation and, when the invocation
+// takes longer than threshold, writes its CPU profile and a heap snapshot to s,
+// replacing the settings read from CFN_PROFILE_THRESHOLD and CFN_PROFILE_DIR.
+//
+// Sinks are created with profiling.NewDirSink or profiling.NewLogSink; a nil
+// Sink writes profiles to the provider logs, without redacting them.
+func WithProfiling(threshold time.Duration, s profiling.Sink) Option {
+	return func(o *options) {
+		o.profiler = profiling.New(threshold, s)
+	}
+}
+
+// WithLocalCallbacks waits in-process for the callbacks of IN_PROGRESS events
+// delayed by up to maxDelay, and calls the handler again with the returned
+// callback context and model, instead of returning to CloudFormation, replacing
+// the delay read from CFN_LOCAL_CALLBACK_DELAY. A maxDelay of 0 turns local
+// callbacks off.
+//
+// Each call is a callback attempt, with its own correlation ID.
+//
+// A callback is only waited for when the invocation has time left, with the 20%
+// buffer of scheduler.ComputeLocal; otherwise the last event is returned.
+func WithLocalCallbacks(maxDelay time.Duration) Option {
+	return func(o *options) {
+		o.localCallbackDelay = maxDelay
+	}
+}
+
+// tracer creates the tracer of the runtime, or returns nil when tracing is off.
+func (o *options) tracer() *tracing.Tracer {
+	if o.traceExporter == nil {
+		return nil
+	}
+
+	return tracing.New(o.traceExporter)
+}
+
+// publisher creates the metrics publisher of an invocation.
+func (o *options) publisher(cfg aws.Config, resourceType string) *metrics.Publisher {
+	switch {
+	case o.metricsSink != nil:
+		return metrics.NewWithSink(o.metricsSink, resourceType)
+	case o.metricsFormat == metrics.FormatEMF:
+		return metrics.NewEMF(logging.ProviderLogOutput(), resourceType)
+	case o.metricsFormat == metrics.FormatText:
+		return metrics.NewWithSink(metrics.NewTextSink(os.Stdout), resourceType)
+	case o.metricsFormat == metrics.FormatPrometheus:
+		if o.prometheusSink == nil {
+			o.prometheusSink = metrics.NewPrometheusSink(o.prometheusPath)
+		}
+		return metrics.NewWithSink(o.prometheusSink, resourceType)
+	default:
+		return metrics.NewV2(cloudwatch.NewFromConfig(cfg), resourceType)
+	}
+}
+
+// level returns the level of the structured logger for an invocation.
+func (o *options) level(typeConfiguration []byte) slog.Level {
+	if l, ok := logging.LevelFromTypeConfiguration(typeConfiguration); ok {
+		return l
+	}
+
+	return o.logLevel
+}
+
+// session creates an AWS session from the provider, applying the runtime configuration.
+func (o *options) session(provider *credentials.CloudFormationCredentialsProvider) *session.Session {
+	return credentials.SessionFromCredentialsProvider(provider, o.endpoints.Config())
+}
+
+// config creates an AWS SDK for Go v2 config from the provider, applying the runtime configuration.
+func (o *options) config(provider *credentials.CloudFormationCredentialsProvider, region string) aws.Config {
+	return credentials.ConfigFromCredentialsProvider(provider, region, o.endpoints)
+}
@@ -0,0 +1,10 @@
+/*
+Package profiling profiles the resource handler invocations that are slower than
+a threshold.
+
+The CPU is sampled during every invocation, but the profile is only kept, with a
+heap snapshot, when the invocation takes longer than the threshold; profiles of
+fast invocations are discarded. Profiles are written to a Sink, such as a local
+directory or the provider logs as base64 chunks, and read with go tool pprof.
+*/
+package profiling
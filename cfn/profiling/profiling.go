@@ -0,0 +1,211 @@
+package profiling
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"time"
+)
+
+const (
+	// ThresholdEnv is the environment variable turning on profiling, set to the
+	// duration above which an invocation is profiled, such as 10s.
+	ThresholdEnv = "CFN_PROFILE_THRESHOLD"
+	// DirEnv is the environment variable naming the directory profiles are
+	// written to. Profiles are written to the provider logs when it's unset.
+	DirEnv = "CFN_PROFILE_DIR"
+)
+
+// Names of the profiles of an invocation.
+const (
+	CPU  = "cpu"
+	Heap = "heap"
+)
+
+// logChunkSize is the size of the profile chunks written to the log,
+// well below the 256 KB limit of a CloudWatch Logs event once encoded.
+const logChunkSize = 96 << 10
+
+// A Profile is a pprof profile of a slow invocation.
+type Profile struct {
+	// Name is the kind of profile, CPU or Heap
+	Name string
+	// ID identifies the invocation, such as its correlation ID
+	ID string
+	// Duration is the duration of the invocation
+	Duration time.Duration
+	// Data is the profile in the gzipped pprof format
+	Data []byte
+}
+
+// A Sink stores profiles.
+type Sink interface {
+	Write(p Profile) error
+}
+
+// dirSink writes profiles to files.
+type dirSink struct {
+	dir string
+}
+
+// NewDirSink creates a Sink writing each profile to a file of dir, named after
+// the invocation and the profile, such as 123456-1.cpu.pprof.
+func NewDirSink(dir string) Sink {
+	return dirSink{dir: dir}
+}
+
+func (s dirSink) Write(p Profile) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+
+	name := strings.NewReplacer("/", "_", string(filepath.Separator), "_").Replace(p.ID)
+	return os.WriteFile(filepath.Join(s.dir, fmt.Sprintf("%s.%s.pprof", name, p.Name)), p.Data, 0o644)
+}
+
+// logSink writes profiles to a log output as JSON records.
+type logSink struct {
+	logger *slog.Logger
+}
+
+// NewLogSink creates a Sink writing profiles to w as JSON records, in base64
+// chunks. The runtime writes them to the provider logs, bypassing the redaction
+// of the provider log output, which would corrupt the chunks.
+//
+// Each chunk is a "Profile chunk" record with the invocation ID, the profile
+// name, and the index and count of chunks; decoding the chunks in order and
+// concatenating them gives the profile.
+func NewLogSink(w io.Writer) Sink {
+	return logSink{logger: slog.New(slog.NewJSONHandler(w, nil))}
+}
+
+func (s logSink) Write(p Profile) error {
+	n := (len(p.Data) + logChunkSize - 1) / logChunkSize
+	for i := 0; i < n; i++ {
+		chunk := p.Data[i*logChunkSize : min((i+1)*logChunkSize, len(p.Data))]
+		s.logger.Info("Profile chunk",
+			"profileId", p.ID,
+			"profile", p.Name,
+			"durationMs", p.Duration.Milliseconds(),
+			"chunk", i+1,
+			"chunks", n,
+			"data", base64.StdEncoding.EncodeToString(chunk),
+		)
+	}
+
+	return nil
+}
+
+// A Profiler profiles the invocations slower than a threshold.
+//
+// A nil Profiler profiles nothing.
+type Profiler struct {
+	threshold time.Duration
+	sink      Sink
+}
+
+// New creates a Profiler writing the profiles of the invocations slower than
+// threshold to s. A nil Sink writes profiles to stdout with NewLogSink, or to
+// the output set with WithLogOutput.
+func New(threshold time.Duration, s Sink) *Profiler {
+	return &Profiler{threshold: threshold, sink: s}
+}
+
+// WithLogOutput returns a copy of the Profiler writing profiles to w with
+// NewLogSink, when it was created without a Sink.
+func (p *Profiler) WithLogOutput(w io.Writer) *Profiler {
+	if p == nil || p.sink != nil {
+		return p
+	}
+
+	return New(p.threshold, NewLogSink(w))
+}
+
+// FromEnv creates the Profiler configured by ThresholdEnv and DirEnv, or returns
+// nil when profiling is off.
+func FromEnv() (*Profiler, error) {
+	v, ok := os.LookupEnv(ThresholdEnv)
+	if !ok || len(v) == 0 {
+		return nil, nil
+	}
+
+	threshold, err := time.ParseDuration(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ThresholdEnv, err)
+	}
+
+	var s Sink
+	if dir := os.Getenv(DirEnv); len(dir) != 0 {
+		s = NewDirSink(dir)
+	}
+
+	return New(threshold, s), nil
+}
+
+// A Run is the profiling of one invocation.
+//
+// A nil Run profiles nothing.
+type Run struct {
+	p     *Profiler
+	id    string
+	start time.Time
+	cpu   bytes.Buffer
+}
+
+// Start starts sampling the CPU for the invocation id.
+//
+// Only one invocation can be profiled at a time; Start returns nil when the
+// CPU is already being profiled.
+func (p *Profiler) Start(id string) *Run {
+	if p == nil {
+		return nil
+	}
+
+	r := &Run{p: p, id: id, start: time.Now()}
+	if err := pprof.StartCPUProfile(&r.cpu); err != nil {
+		log.Printf("Unable to profile the invocation: %v", err)
+		return nil
+	}
+
+	return r
+}
+
+// Stop stops sampling the CPU and, when the invocation was slower than the
+// threshold, writes its CPU profile and a heap snapshot to the Sink.
+func (r *Run) Stop() error {
+	if r == nil {
+		return nil
+	}
+
+	pprof.StopCPUProfile()
+	d := time.Since(r.start)
+	if d < r.p.threshold {
+		return nil
+	}
+
+	// the heap profile reports the state as of the last garbage collection
+	runtime.GC()
+	var heap bytes.Buffer
+	if err := pprof.Lookup("heap").WriteTo(&heap, 0); err != nil {
+		return fmt.Errorf("unable to take a heap snapshot: %w", err)
+	}
+
+	s := r.p.sink
+	if s == nil {
+		s = NewLogSink(os.Stdout)
+	}
+
+	return errors.Join(
+		s.Write(Profile{Name: CPU, ID: r.id, Duration: d, Data: r.cpu.Bytes()}),
+		s.Write(Profile{Name: Heap, ID: r.id, Duration: d, Data: heap.Bytes()}),
+	)
+}
@@ -0,0 +1,164 @@
+package profiling
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memorySink keeps the profiles written to it.
+type memorySink struct {
+	profiles []Profile
+}
+
+func (s *memorySink) Write(p Profile) error {
+	s.profiles = append(s.profiles, p)
+	return nil
+}
+
+func TestRun_Stop(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		want      []string
+	}{
+		{"Slow", 0, []string{CPU, Heap}},
+		{"Fast", time.Hour, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &memorySink{}
+			r := New(tt.threshold, s).Start("123456-1")
+			if r == nil {
+				t.Fatalf("Start() = nil")
+			}
+			if err := r.Stop(); err != nil {
+				t.Fatalf("Stop() = %v", err)
+			}
+
+			var got []string
+			for _, p := range s.profiles {
+				got = append(got, p.Name)
+				if p.ID != "123456-1" || len(p.Data) == 0 {
+					t.Errorf("Profile %s = %+v", p.Name, p)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Profiles = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProfiler_StartTwice(t *testing.T) {
+	p := New(time.Hour, &memorySink{})
+	r := p.Start("1")
+	defer r.Stop()
+
+	if r2 := p.Start("2"); r2 != nil {
+		t.Errorf("Start() while profiling = %v; want nil", r2)
+	}
+}
+
+func TestNilProfiler(t *testing.T) {
+	var p *Profiler
+	if err := p.Start("1").Stop(); err != nil {
+		t.Errorf("Stop() = %v", err)
+	}
+}
+
+func TestDirSink(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "profiles")
+	if err := NewDirSink(dir).Write(Profile{Name: CPU, ID: "a/b-1", Data: []byte("pprof")}); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "a_b-1.cpu.pprof"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "pprof" {
+		t.Errorf("Profile = %q", b)
+	}
+}
+
+func TestLogSink(t *testing.T) {
+	var buf bytes.Buffer
+	data := bytes.Repeat([]byte("0123456789"), logChunkSize/5)
+	if err := NewLogSink(&buf).Write(Profile{Name: Heap, ID: "123456-1", Data: data}); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+
+	var got []byte
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	for i, line := range lines {
+		var rec struct {
+			ProfileID string
+			Profile   string
+			Chunk     int
+			Chunks    int
+			Data      string
+		}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec.ProfileID != "123456-1" || rec.Profile != Heap || rec.Chunk != i+1 || rec.Chunks != 2 {
+			t.Errorf("Chunk %d = %+v", i, rec)
+		}
+		b, err := base64.StdEncoding.DecodeString(rec.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, b...)
+	}
+	if len(lines) != 2 {
+		t.Errorf("Chunks = %d; want 2", len(lines))
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Decoded profile differs from the written one")
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv(ThresholdEnv, "")
+	if p, err := FromEnv(); p != nil || err != nil {
+		t.Errorf("FromEnv() = %v, %v; want nil, nil", p, err)
+	}
+
+	t.Setenv(ThresholdEnv, "soon")
+	if _, err := FromEnv(); err == nil {
+		t.Errorf("Expected an error for an invalid threshold")
+	}
+
+	t.Setenv(ThresholdEnv, "5s")
+	t.Setenv(DirEnv, "/tmp/profiles")
+	p, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv() = %v", err)
+	}
+	if p.threshold != 5*time.Second || p.sink != NewDirSink("/tmp/profiles") {
+		t.Errorf("FromEnv() = %+v", p)
+	}
+}
+
+func TestProfiler_WithLogOutput(t *testing.T) {
+	var buf bytes.Buffer
+	r := New(0, nil).WithLogOutput(&buf).Start("123456-1")
+	if err := r.Stop(); err != nil {
+		t.Fatalf("Stop() = %v", err)
+	}
+	if !strings.Contains(buf.String(), `"profileId":"123456-1"`) {
+		t.Errorf("Output = %q; want the profile chunks", buf.String())
+	}
+
+	// a Sink set explicitly is kept
+	s := &memorySink{}
+	if p := New(0, s).WithLogOutput(&buf); p.sink != s {
+		t.Errorf("WithLogOutput() replaced the Sink")
+	}
+}
@@ -9,8 +9,15 @@ import (
 )
 
 // reportErr is an unexported struct that handles reporting of errors.
+//
+// An invocation counts as a single exception, however many errors it runs into:
+// the last error recorded is the one published by publish.
 type reportErr struct {
 	metricsPublisher *metrics.Publisher
+
+	action    string
+	exception error
+	at        time.Time
 }
 
 // NewReportErr is a factory func that returns a pointer to a struct
@@ -23,6 +30,41 @@ func newReportErr(metricsPublisher *metrics.Publisher) *reportErr {
 // Report publishes errors and reports error status to Cloudformation.
 func (r *reportErr) report(event *event, message string, err error, errCode string) (response, error) {
 	m := fmt.Sprintf("Unable to complete request; %s error", message)
-	r.metricsPublisher.PublishExceptionMetric(time.Now(), string(event.Action), err)
+	r.fail(event.Action, coded(err, errCode))
 	return newFailedResponse(cfnerr.New(serviceInternalError, m, err), event.BearerToken), err
 }
+
+// reportFailure publishes errors and reports a failed status with the given handler
+// error code, for failures that are attributable to the request rather than the runtime.
+func (r *reportErr) reportFailure(event *event, err error, errCode string) response {
+	r.fail(event.Action, coded(err, errCode))
+	resp := newFailedResponse(err, event.BearerToken)
+	resp.ErrorCode = errCode
+	return resp
+}
+
+// fail records err as the exception of the invocation, replacing any recorded before.
+func (r *reportErr) fail(action string, err error) {
+	r.action = action
+	r.exception = err
+	r.at = time.Now()
+}
+
+// publish publishes the exception metric of the invocation, if it failed.
+func (r *reportErr) publish() {
+	if r.exception == nil {
+		return
+	}
+
+	r.metricsPublisher.PublishExceptionMetric(r.at, r.action, r.exception)
+}
+
+// coded gives err the code when it doesn't carry one, so its exception
+// metric isn't reported with an Unknown exception type.
+func coded(err error, code string) error {
+	if metrics.ExceptionType(err) != metrics.ExceptionTypeUnknown {
+		return err
+	}
+
+	return cfnerr.New(code, err.Error(), nil)
+}
@@ -1,6 +1,9 @@
 package cfn
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/encoding"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
@@ -100,3 +103,16 @@ func newResponse(pevt *handler.ProgressEvent, bearerToken string) (response, err
 
 	return resp, nil
 }
+
+// withReference appends the correlation ID of the invocation to a failure message.
+func withReference(message string, id string) string {
+	ref := fmt.Sprintf("(ref: %s)", id)
+	if strings.HasSuffix(message, ref) {
+		return message
+	}
+	if len(message) == 0 {
+		return ref
+	}
+
+	return message + " " + ref
+}
@@ -75,3 +75,21 @@ func TestResponseMarshalJSON(t *testing.T) {
 	}
 
 }
+
+func TestWithReference(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{"Empty", "", "(ref: 123456-2)"},
+		{"Message", "Bucket not found", "Bucket not found (ref: 123456-2)"},
+		{"Already Referenced", "Bucket not found (ref: 123456-2)", "Bucket not found (ref: 123456-2)"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withReference(tt.message, "123456-2"); got != tt.want {
+				t.Errorf("withReference() = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package cfn
+
+import (
+	"time"
+
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+)
+
+// runtimeContextKey is the callback context key reserved for the runtime's own
+// state, carried between the invocations of an operation.
+const runtimeContextKey = "__cfnRuntime"
+
+// runtimeContext is the state the runtime keeps in the callback context.
+type runtimeContext struct {
+	// Attempt is the number of the invocation within the operation, starting at 1.
+	Attempt int
+
+	// Start is when the first invocation of the operation started.
+	Start time.Time
+
+	// TraceParent is the W3C traceparent of the span of the previous invocation.
+	TraceParent string
+}
+
+// popRuntimeContext removes the runtime state from a callback context so handlers
+// never see it, returning the state for the current invocation started at now.
+func popRuntimeContext(callbackContext map[string]interface{}, now time.Time) runtimeContext {
+	rc := runtimeContext{Attempt: 1, Start: now}
+
+	v, ok := callbackContext[runtimeContextKey]
+	if !ok {
+		return rc
+	}
+	delete(callbackContext, runtimeContextKey)
+
+	if m, ok := v.(map[string]interface{}); ok {
+		// JSON numbers decode as float64
+		if attempt, ok := m["attempt"].(float64); ok {
+			rc.Attempt = int(attempt) + 1
+		}
+		if start, ok := m["startTime"].(float64); ok {
+			rc.Start = time.UnixMilli(int64(start))
+		}
+		if traceParent, ok := m["traceparent"].(string); ok {
+			rc.TraceParent = traceParent
+		}
+	}
+
+	return rc
+}
+
+// pushRuntimeContext adds the runtime state to the callback context of an
+// IN_PROGRESS event, so the next invocation can pick it up.
+func pushRuntimeContext(pevt *handler.ProgressEvent, rc runtimeContext) {
+	if pevt.OperationStatus != handler.InProgress {
+		return
+	}
+
+	// copy so the handler's map isn't modified
+	callbackContext := make(map[string]interface{}, len(pevt.CallbackContext)+1)
+	for k, v := range pevt.CallbackContext {
+		callbackContext[k] = v
+	}
+	state := map[string]interface{}{
+		"attempt":   rc.Attempt,
+		"startTime": rc.Start.UnixMilli(),
+	}
+	if len(rc.TraceParent) != 0 {
+		state["traceparent"] = rc.TraceParent
+	}
+	callbackContext[runtimeContextKey] = state
+
+	pevt.CallbackContext = callbackContext
+}
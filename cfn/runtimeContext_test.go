@@ -0,0 +1,56 @@
+package cfn
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+)
+
+func TestRuntimeContext(t *testing.T) {
+	t.Run("First Attempt", func(t *testing.T) {
+		if rc := popRuntimeContext(nil, time.Now()); rc.Attempt != 1 {
+			t.Fatalf("Unexpected attempt: %v", rc.Attempt)
+		}
+	})
+
+	t.Run("Round Trip", func(t *testing.T) {
+		pevt := handler.ProgressEvent{
+			OperationStatus: handler.InProgress,
+			CallbackContext: map[string]interface{}{"bucket": "pineapple-pizza"},
+		}
+		start := time.Now().Add(-time.Minute).Truncate(time.Millisecond)
+		pushRuntimeContext(&pevt, runtimeContext{Attempt: 1, Start: start})
+
+		// the callback context is sent back as JSON
+		b, err := json.Marshal(pevt.CallbackContext)
+		if err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+		var callbackContext map[string]interface{}
+		if err := json.Unmarshal(b, &callbackContext); err != nil {
+			t.Fatalf("Error returned: %v", err)
+		}
+
+		rc := popRuntimeContext(callbackContext, time.Now())
+		if rc.Attempt != 2 {
+			t.Fatalf("Unexpected attempt: %v", rc.Attempt)
+		}
+		if !rc.Start.Equal(start) {
+			t.Fatalf("Unexpected start: %v; want %v", rc.Start, start)
+		}
+		if _, ok := callbackContext[runtimeContextKey]; ok || callbackContext["bucket"] != "pineapple-pizza" {
+			t.Fatalf("Unexpected callback context: %v", callbackContext)
+		}
+	})
+
+	t.Run("Terminal", func(t *testing.T) {
+		pevt := handler.ProgressEvent{OperationStatus: handler.Success}
+		pushRuntimeContext(&pevt, runtimeContext{Attempt: 3})
+
+		if pevt.CallbackContext != nil {
+			t.Fatalf("Unexpected callback context: %v", pevt.CallbackContext)
+		}
+	})
+}
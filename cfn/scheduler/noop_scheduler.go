@@ -1,15 +1,14 @@
 package scheduler
 
 import (
+	"context"
 	"log"
 
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/logging"
-	"github.com/aws/aws-sdk-go/service/cloudwatchevents"
-	"github.com/aws/aws-sdk-go/service/cloudwatchevents/cloudwatcheventsiface"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
 )
 
 type noopCloudWatchClient struct {
-	cloudwatcheventsiface.CloudWatchEventsAPI
 	logger *log.Logger
 }
 
@@ -19,27 +18,27 @@ func newNoopCloudWatchClient() *noopCloudWatchClient {
 	}
 }
 
-func (m *noopCloudWatchClient) PutRule(in *cloudwatchevents.PutRuleInput) (*cloudwatchevents.PutRuleOutput, error) {
+func (m *noopCloudWatchClient) PutRule(ctx context.Context, in *eventbridge.PutRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutRuleOutput, error) {
 	m.logger.Printf("Rule name: %v", *in.Name)
 	// out implementation doesn't care about the response
 	return nil, nil
 }
 
-func (m *noopCloudWatchClient) PutTargets(in *cloudwatchevents.PutTargetsInput) (*cloudwatchevents.PutTargetsOutput, error) {
+func (m *noopCloudWatchClient) PutTargets(ctx context.Context, in *eventbridge.PutTargetsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutTargetsOutput, error) {
 	m.logger.Printf("Target ID: %v", *in.Targets[0].Id)
 	// out implementation doesn't care about the response
 	return nil, nil
 
 }
 
-func (m *noopCloudWatchClient) DeleteRule(in *cloudwatchevents.DeleteRuleInput) (*cloudwatchevents.DeleteRuleOutput, error) {
+func (m *noopCloudWatchClient) DeleteRule(ctx context.Context, in *eventbridge.DeleteRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.DeleteRuleOutput, error) {
 	m.logger.Printf("Rule name: %v", *in.Name)
 	// out implementation doesn't care about the response
 	return nil, nil
 }
 
-func (m *noopCloudWatchClient) RemoveTargets(in *cloudwatchevents.RemoveTargetsInput) (*cloudwatchevents.RemoveTargetsOutput, error) {
-	m.logger.Printf("Target ID: %v", *in.Ids[0])
+func (m *noopCloudWatchClient) RemoveTargets(ctx context.Context, in *eventbridge.RemoveTargetsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.RemoveTargetsOutput, error) {
+	m.logger.Printf("Target ID: %v", in.Ids[0])
 	// out implementation doesn't care about the response
 	return nil, nil
 }
@@ -1,6 +1,3 @@
-//go:build scheduler
-// +build scheduler
-
 /*
 Package scheduler handles rescheduling resource provider handlers
 when required by in_progress events.
@@ -12,13 +9,16 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/cfnerr"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/logging"
 	"github.com/aws/aws-lambda-go/lambdacontext"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/cloudwatchevents"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
 	"github.com/aws/aws-sdk-go/service/cloudwatchevents/cloudwatcheventsiface"
 	"github.com/google/uuid"
 )
@@ -34,6 +34,37 @@ const (
 	ServiceInternalError string = "ServiceInternal"
 )
 
+// EnabledEnv is the environment variable that turns rescheduling through CloudWatch
+// Events off when set to false, in which case the rules and targets are only logged.
+const EnabledEnv = "CFN_SCHEDULER"
+
+// LocalDelayEnv is the environment variable turning on the local callbacks of the
+// runtime, set to the longest callback delay waited for in-process, such as 10s.
+const LocalDelayEnv = "CFN_LOCAL_CALLBACK_DELAY"
+
+// LocalDelayFromEnv returns the longest callback delay set by LocalDelayEnv, or 0
+// when local callbacks are off.
+func LocalDelayFromEnv() (time.Duration, error) {
+	v := os.Getenv(LocalDelayEnv)
+	if len(v) == 0 {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", LocalDelayEnv, err)
+	}
+
+	return d, nil
+}
+
+// ComputeLocal reports whether a callback secsFromNow seconds away can be waited
+// for in the invocation ending at deadline: the delay must be under a minute, the
+// granularity of CloudWatch Events, and leave a 20% buffer before the deadline.
+func ComputeLocal(deadline time.Time, secsFromNow int64) bool {
+	return secsFromNow < 60 && time.Until(deadline).Seconds() > float64(secsFromNow)*1.2
+}
+
 // Result holds the confirmation of the rescheduled invocation.
 type Result struct {
 	// Denotes if the computation was done locally.
@@ -49,6 +80,18 @@ type ScheduleIDS struct {
 	Handler string
 }
 
+// CloudWatchEventsAPI is the subset of the CloudWatch Events API used to
+// reschedule invocations.
+//
+// It is satisfied by the AWS SDK for Go v2 EventBridge client, *eventbridge.Client,
+// which shares its API with CloudWatch Events.
+type CloudWatchEventsAPI interface {
+	PutRule(ctx context.Context, params *eventbridge.PutRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutRuleOutput, error)
+	PutTargets(ctx context.Context, params *eventbridge.PutTargetsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutTargetsOutput, error)
+	RemoveTargets(ctx context.Context, params *eventbridge.RemoveTargetsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.RemoveTargetsOutput, error)
+	DeleteRule(ctx context.Context, params *eventbridge.DeleteRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.DeleteRuleOutput, error)
+}
+
 // Scheduler is the implementation of the rescheduler of an invoke
 //
 // Invokes will be rescheduled if a handler takes longer than 60
@@ -56,17 +99,41 @@ type ScheduleIDS struct {
 // via a CRON expression
 type Scheduler struct {
 	logger *log.Logger
-	client cloudwatcheventsiface.CloudWatchEventsAPI
+	client CloudWatchEventsAPI
 }
 
-// New creates a CloudWatchScheduler and returns a pointer to the struct.
+// New creates a CloudWatchScheduler using a client of the AWS SDK for Go v1
+// and returns a pointer to the struct.
+//
+// Deprecated: use NewV2 with a client of the AWS SDK for Go v2.
 func New(client cloudwatcheventsiface.CloudWatchEventsAPI) *Scheduler {
+	return NewV2(cloudWatchEventsV1{client: client})
+}
+
+// NewV2 creates a CloudWatchScheduler and returns a pointer to the struct.
+//
+// If rescheduling is turned off through CFN_SCHEDULER, the scheduler only logs
+// the CloudWatch Events calls.
+func NewV2(client CloudWatchEventsAPI) *Scheduler {
+	if v, err := strconv.ParseBool(os.Getenv(EnabledEnv)); err == nil && !v {
+		return NewNoop()
+	}
+
 	return &Scheduler{
 		logger: logging.New("scheduler"),
 		client: client,
 	}
 }
 
+// NewNoop creates a Scheduler that logs the CloudWatch Events calls
+// instead of making them, for example when testing locally.
+func NewNoop() *Scheduler {
+	return &Scheduler{
+		logger: logging.New("scheduler"),
+		client: newNoopCloudWatchClient(),
+	}
+}
+
 // Reschedule when a handler requests a sub-minute callback delay, and if the lambda
 // invocation has enough runtime (with 20% buffer), we can reschedule from a thread wait
 // otherwise we re-invoke through CloudWatchEvents which have a granularity of
@@ -80,14 +147,13 @@ func (s *Scheduler) Reschedule(lambdaCtx context.Context, secsFromNow int64, cal
 	}
 
 	deadline, _ := lambdaCtx.Deadline()
-	secondsUnitDeadline := time.Until(deadline).Seconds()
 
 	if secsFromNow <= 0 {
 		err := errors.New("Scheduled seconds must be greater than 0")
 		return nil, cfnerr.New(ServiceInternalError, "Scheduled seconds must be greater than 0", err)
 	}
 
-	if secsFromNow < 60 && secondsUnitDeadline > float64(secsFromNow)*1.2 {
+	if ComputeLocal(deadline, secsFromNow) {
 
 		s.logger.Printf("Scheduling re-invoke locally after %v seconds, with Context %s", secsFromNow, string(callbackRequest))
 
@@ -103,20 +169,20 @@ func (s *Scheduler) Reschedule(lambdaCtx context.Context, secsFromNow int64, cal
 
 	cr := GenerateOneTimeCronExpression(secsFromNow, time.Now())
 	s.logger.Printf("Scheduling re-invoke at %s \n", cr)
-	_, rerr := s.client.PutRule(&cloudwatchevents.PutRuleInput{
+	_, rerr := s.client.PutRule(context.Background(), &eventbridge.PutRuleInput{
 
 		Name:               aws.String(invocationIDS.Handler),
 		ScheduleExpression: aws.String(cr),
-		State:              aws.String(cloudwatchevents.RuleStateEnabled),
+		State:              types.RuleStateEnabled,
 	})
 
 	if rerr != nil {
 		return nil, cfnerr.New(ServiceInternalError, "Schedule error", rerr)
 	}
-	_, perr := s.client.PutTargets(&cloudwatchevents.PutTargetsInput{
+	_, perr := s.client.PutTargets(context.Background(), &eventbridge.PutTargetsInput{
 		Rule: aws.String(invocationIDS.Handler),
-		Targets: []*cloudwatchevents.Target{
-			&cloudwatchevents.Target{
+		Targets: []types.Target{
+			{
 				Arn:   aws.String(lc.InvokedFunctionArn),
 				Id:    aws.String(invocationIDS.Target),
 				Input: aws.String(string(callbackRequest)),
@@ -140,9 +206,9 @@ func (s *Scheduler) CleanupEvents(ruleName string, targetID string) error {
 	if len(targetID) == 0 {
 		return cfnerr.New(ServiceInternalError, "Unable to complete request", errors.New("targetID is required"))
 	}
-	_, err := s.client.RemoveTargets(&cloudwatchevents.RemoveTargetsInput{
-		Ids: []*string{
-			aws.String(targetID),
+	_, err := s.client.RemoveTargets(context.Background(), &eventbridge.RemoveTargetsInput{
+		Ids: []string{
+			targetID,
 		},
 		Rule: aws.String(ruleName),
 	})
@@ -153,7 +219,7 @@ func (s *Scheduler) CleanupEvents(ruleName string, targetID string) error {
 	}
 	s.logger.Printf("CloudWatchEvents Target (targetId=%s) removed", targetID)
 
-	_, rerr := s.client.DeleteRule(&cloudwatchevents.DeleteRuleInput{
+	_, rerr := s.client.DeleteRule(context.Background(), &eventbridge.DeleteRuleInput{
 		Name: aws.String(ruleName),
 	})
 	if rerr != nil {
@@ -8,6 +8,7 @@ import (
 
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/logging"
 	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
 	"github.com/aws/aws-sdk-go/service/cloudwatchevents"
 	"github.com/aws/aws-sdk-go/service/cloudwatchevents/cloudwatcheventsiface"
 )
@@ -22,7 +23,6 @@ const (
 
 // MockedEvents mocks the call to AWS CloudWatch Events
 type MockedEvents struct {
-	cloudwatcheventsiface.CloudWatchEventsAPI
 	RuleName   string
 	TargetName string
 }
@@ -31,24 +31,24 @@ func NewMockEvents() *MockedEvents {
 	return &MockedEvents{}
 }
 
-func (m *MockedEvents) PutRule(in *cloudwatchevents.PutRuleInput) (*cloudwatchevents.PutRuleOutput, error) {
+func (m *MockedEvents) PutRule(ctx context.Context, in *eventbridge.PutRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutRuleOutput, error) {
 	m.RuleName = *in.Name
 	return nil, nil
 }
 
-func (m *MockedEvents) PutTargets(in *cloudwatchevents.PutTargetsInput) (*cloudwatchevents.PutTargetsOutput, error) {
+func (m *MockedEvents) PutTargets(ctx context.Context, in *eventbridge.PutTargetsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutTargetsOutput, error) {
 	m.TargetName = *in.Targets[0].Id
 	return nil, nil
 
 }
 
-func (m *MockedEvents) DeleteRule(in *cloudwatchevents.DeleteRuleInput) (*cloudwatchevents.DeleteRuleOutput, error) {
+func (m *MockedEvents) DeleteRule(ctx context.Context, in *eventbridge.DeleteRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.DeleteRuleOutput, error) {
 	m.RuleName = *in.Name
 	return nil, nil
 }
 
-func (m *MockedEvents) RemoveTargets(in *cloudwatchevents.RemoveTargetsInput) (*cloudwatchevents.RemoveTargetsOutput, error) {
-	m.TargetName = *in.Ids[0]
+func (m *MockedEvents) RemoveTargets(ctx context.Context, in *eventbridge.RemoveTargetsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.RemoveTargetsOutput, error) {
+	m.TargetName = in.Ids[0]
 	return nil, nil
 }
 
@@ -92,7 +92,7 @@ func TestCloudWatchSchedulerRescheduleAfterMinutes(t *testing.T) {
 	defer cancel2()
 
 	type fields struct {
-		Client cloudwatcheventsiface.CloudWatchEventsAPI
+		Client CloudWatchEventsAPI
 	}
 	type args struct {
 		ctx             context.Context
@@ -143,7 +143,7 @@ func TestCloudWatchSchedulerRescheduleAfterMinutes(t *testing.T) {
 
 func TestCloudWatchSchedulerCleanupCloudWatchEvents(t *testing.T) {
 	type fields struct {
-		Client cloudwatcheventsiface.CloudWatchEventsAPI
+		Client CloudWatchEventsAPI
 	}
 	type args struct {
 		cloudWatchEventsRuleName string
@@ -232,3 +232,113 @@ func TestGenerateCloudWatchIDS(t *testing.T) {
 		})
 	}
 }
+
+// MockedV1Events mocks the calls of an AWS SDK for Go v1 CloudWatch Events client.
+type MockedV1Events struct {
+	cloudwatcheventsiface.CloudWatchEventsAPI
+	Rule    *cloudwatchevents.PutRuleInput
+	Targets *cloudwatchevents.PutTargetsInput
+	Removed []string
+}
+
+func (m *MockedV1Events) PutRule(in *cloudwatchevents.PutRuleInput) (*cloudwatchevents.PutRuleOutput, error) {
+	m.Rule = in
+	return nil, nil
+}
+
+func (m *MockedV1Events) PutTargets(in *cloudwatchevents.PutTargetsInput) (*cloudwatchevents.PutTargetsOutput, error) {
+	m.Targets = in
+	return nil, nil
+}
+
+func (m *MockedV1Events) RemoveTargets(in *cloudwatchevents.RemoveTargetsInput) (*cloudwatchevents.RemoveTargetsOutput, error) {
+	m.Removed = append(m.Removed, *in.Ids[0])
+	return nil, nil
+}
+
+func (m *MockedV1Events) DeleteRule(in *cloudwatchevents.DeleteRuleInput) (*cloudwatchevents.DeleteRuleOutput, error) {
+	m.Removed = append(m.Removed, *in.Name)
+	return nil, nil
+}
+
+func TestNew(t *testing.T) {
+	client := &MockedV1Events{}
+	s := New(client)
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Hour))
+	defer cancel()
+	ids, _ := GenerateCloudWatchIDS()
+	if _, err := s.Reschedule(lambdacontext.NewContext(ctx, &lambdacontext.LambdaContext{InvokedFunctionArn: Arn}), 120, "{}", ids); err != nil {
+		t.Fatalf("Error returned: %v", err)
+	}
+	if client.Rule == nil || *client.Rule.Name != ids.Handler || *client.Rule.State != "ENABLED" {
+		t.Errorf("PutRule input = %+v", client.Rule)
+	}
+	if client.Targets == nil || len(client.Targets.Targets) != 1 || *client.Targets.Targets[0].Id != ids.Target || *client.Targets.Targets[0].Arn != Arn {
+		t.Errorf("PutTargets input = %+v", client.Targets)
+	}
+
+	if err := s.CleanupEvents(ids.Handler, ids.Target); err != nil {
+		t.Fatalf("Error returned: %v", err)
+	}
+	if len(client.Removed) != 2 || client.Removed[0] != ids.Target || client.Removed[1] != ids.Handler {
+		t.Errorf("Removed = %v", client.Removed)
+	}
+}
+
+func TestNewV2(t *testing.T) {
+	t.Run("Enabled", func(t *testing.T) {
+		client := NewMockEvents()
+		if s := NewV2(client); s.client != client {
+			t.Fatalf("Expected the supplied client")
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Setenv(EnabledEnv, "false")
+
+		s := NewV2(NewMockEvents())
+		if _, ok := s.client.(*noopCloudWatchClient); !ok {
+			t.Fatalf("Expected the noop client, got %T", s.client)
+		}
+	})
+}
+
+func TestComputeLocal(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name        string
+		deadline    time.Time
+		secsFromNow int64
+		want        bool
+	}{
+		{"Short delay with time left", now.Add(time.Minute), 5, true},
+		{"Within the 20% buffer", now.Add(5500 * time.Millisecond), 5, false},
+		{"A minute or more", now.Add(15 * time.Minute), 60, false},
+		{"Past the deadline", now.Add(-time.Second), 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ComputeLocal(tt.deadline, tt.secsFromNow); got != tt.want {
+				t.Errorf("ComputeLocal() = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalDelayFromEnv(t *testing.T) {
+	t.Setenv(LocalDelayEnv, "")
+	if d, err := LocalDelayFromEnv(); d != 0 || err != nil {
+		t.Errorf("LocalDelayFromEnv() = %v, %v; want 0, nil", d, err)
+	}
+
+	t.Setenv(LocalDelayEnv, "10s")
+	if d, err := LocalDelayFromEnv(); d != 10*time.Second || err != nil {
+		t.Errorf("LocalDelayFromEnv() = %v, %v; want 10s, nil", d, err)
+	}
+
+	t.Setenv(LocalDelayEnv, "soon")
+	if _, err := LocalDelayFromEnv(); err == nil {
+		t.Errorf("Expected an error for an invalid delay")
+	}
+}
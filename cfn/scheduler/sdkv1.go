@@ -0,0 +1,112 @@
+package scheduler
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchevents"
+	"github.com/aws/aws-sdk-go/service/cloudwatchevents/cloudwatcheventsiface"
+)
+
+// cloudWatchEventsV1 adapts an AWS SDK for Go v1 client to CloudWatchEventsAPI.
+//
+// It calls the same methods as the Scheduler used to, so clients mocking only
+// those keep working.
+type cloudWatchEventsV1 struct {
+	client cloudwatcheventsiface.CloudWatchEventsAPI
+}
+
+// PutRule creates the rule with the v1 client.
+func (c cloudWatchEventsV1) PutRule(ctx context.Context, params *eventbridge.PutRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutRuleOutput, error) {
+	in := &cloudwatchevents.PutRuleInput{
+		Name:               params.Name,
+		Description:        params.Description,
+		EventBusName:       params.EventBusName,
+		EventPattern:       params.EventPattern,
+		RoleArn:            params.RoleArn,
+		ScheduleExpression: params.ScheduleExpression,
+	}
+	if len(params.State) != 0 {
+		in.State = aws.String(string(params.State))
+	}
+
+	out, err := c.client.PutRule(in)
+	if err != nil {
+		return nil, err
+	}
+
+	if out == nil {
+		return &eventbridge.PutRuleOutput{}, nil
+	}
+
+	return &eventbridge.PutRuleOutput{RuleArn: out.RuleArn}, nil
+}
+
+// PutTargets adds the targets with the v1 client.
+func (c cloudWatchEventsV1) PutTargets(ctx context.Context, params *eventbridge.PutTargetsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutTargetsOutput, error) {
+	in := &cloudwatchevents.PutTargetsInput{
+		Rule:         params.Rule,
+		EventBusName: params.EventBusName,
+	}
+	for _, t := range params.Targets {
+		in.Targets = append(in.Targets, &cloudwatchevents.Target{
+			Arn:       t.Arn,
+			Id:        t.Id,
+			Input:     t.Input,
+			InputPath: t.InputPath,
+			RoleArn:   t.RoleArn,
+		})
+	}
+
+	out, err := c.client.PutTargets(in)
+	if err != nil {
+		return nil, err
+	}
+
+	if out == nil {
+		return &eventbridge.PutTargetsOutput{}, nil
+	}
+
+	return &eventbridge.PutTargetsOutput{FailedEntryCount: int32(aws.Int64Value(out.FailedEntryCount))}, nil
+}
+
+// RemoveTargets removes the targets with the v1 client.
+func (c cloudWatchEventsV1) RemoveTargets(ctx context.Context, params *eventbridge.RemoveTargetsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.RemoveTargetsOutput, error) {
+	in := &cloudwatchevents.RemoveTargetsInput{
+		Rule:         params.Rule,
+		Ids:          aws.StringSlice(params.Ids),
+		EventBusName: params.EventBusName,
+	}
+	if params.Force {
+		in.Force = aws.Bool(true)
+	}
+
+	out, err := c.client.RemoveTargets(in)
+	if err != nil {
+		return nil, err
+	}
+
+	if out == nil {
+		return &eventbridge.RemoveTargetsOutput{}, nil
+	}
+
+	return &eventbridge.RemoveTargetsOutput{FailedEntryCount: int32(aws.Int64Value(out.FailedEntryCount))}, nil
+}
+
+// DeleteRule deletes the rule with the v1 client.
+func (c cloudWatchEventsV1) DeleteRule(ctx context.Context, params *eventbridge.DeleteRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.DeleteRuleOutput, error) {
+	in := &cloudwatchevents.DeleteRuleInput{
+		Name:         params.Name,
+		EventBusName: params.EventBusName,
+	}
+	if params.Force {
+		in.Force = aws.Bool(true)
+	}
+
+	if _, err := c.client.DeleteRule(in); err != nil {
+		return nil, err
+	}
+
+	return &eventbridge.DeleteRuleOutput{}, nil
+}
@@ -0,0 +1,70 @@
+package cfn
+
+import (
+	"encoding/json"
+	"log/slog"
+	"time"
+)
+
+// summaryMessage is the message of the record logged at the end of every invocation.
+const summaryMessage = "Invocation summary"
+
+// Outcomes of sending the metrics of an invocation.
+const (
+	metricsFlushOK     = "OK"
+	metricsFlushFailed = "FAILED"
+)
+
+// invocationSummary collects the facts logged in one record at the end of an
+// invocation, so log queries can aggregate them.
+type invocationSummary struct {
+	action  string
+	attempt int
+	start   time.Time
+
+	// decode is the time spent reading the event and preparing the request,
+	// before the handler is called
+	decode time.Duration
+	// handler is the time spent in the handler
+	handler time.Duration
+	// encode is the time spent building the response from the progress event
+	encode time.Duration
+}
+
+// log writes the summary of the invocation that returned resp, given the error
+// of sending its metrics.
+func (s *invocationSummary) log(resp response, flushErr error) {
+	flush := metricsFlushOK
+	if flushErr != nil {
+		flush = metricsFlushFailed
+	}
+
+	slog.Info(summaryMessage, slog.Group("invocation",
+		slog.String("action", s.action),
+		slog.String("status", string(resp.OperationStatus)),
+		slog.String("errorCode", resp.ErrorCode),
+		slog.Int("attempt", s.attempt),
+		slog.Int64("durationMs", time.Since(s.start).Milliseconds()),
+		slog.Int64("decodeMs", s.decode.Milliseconds()),
+		slog.Int64("handlerMs", s.handler.Milliseconds()),
+		slog.Int64("encodeMs", s.encode.Milliseconds()),
+		slog.Int64("callbackDelaySeconds", resp.CallbackDelaySeconds),
+		slog.Int("modelBytes", modelSize(resp)),
+		slog.String("metricsFlush", flush),
+	))
+}
+
+// modelSize returns the size in bytes of the JSON encoding of the models of a response.
+func modelSize(resp response) int {
+	var n int
+	if resp.ResourceModel != nil {
+		b, _ := json.Marshal(resp.ResourceModel)
+		n += len(b)
+	}
+	for _, m := range resp.ResourceModels {
+		b, _ := json.Marshal(m)
+		n += len(b)
+	}
+
+	return n
+}
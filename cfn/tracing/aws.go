@@ -0,0 +1,108 @@
+package tracing
+
+import (
+	"context"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Names of the SDK request handlers tracing AWS SDK for Go v1 calls.
+const (
+	startHandlerName = "cfn.tracing.Start"
+	endHandlerName   = "cfn.tracing.End"
+)
+
+// spanKey is the context key of the span of an AWS SDK for Go v1 call.
+type spanKey struct{}
+
+// AppendMiddlewares adds a middleware to AWS SDK for Go v2 API options that
+// starts a client span for each API call, such as aws.Config.APIOptions.
+//
+// The spans are children of the span in the context of the call, so calls made
+// with the context of a handler request are part of the trace of the invocation.
+func AppendMiddlewares(apiOptions *[]func(*middleware.Stack) error) {
+	*apiOptions = append(*apiOptions, func(s *middleware.Stack) error {
+		return s.Initialize.Add(middleware.InitializeMiddlewareFunc("CfnTracing", handleInitialize), middleware.After)
+	})
+}
+
+func handleInitialize(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	service := awsmiddleware.GetServiceID(ctx)
+	operation := awsmiddleware.GetOperationName(ctx)
+
+	ctx, span := otel.Tracer(tracerName).Start(ctx, service+"."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "aws-api"),
+			attribute.String("rpc.service", service),
+			attribute.String("rpc.method", operation),
+		),
+	)
+	defer span.End()
+
+	out, metadata, err := next.HandleInitialize(ctx, in)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return out, metadata, err
+}
+
+// Install starts a client span for each API call made with an AWS SDK for Go v1
+// session, and with the sessions copied from it, such as the ones of assumed roles.
+//
+// As with AppendMiddlewares, the spans are children of the span in the context
+// of the call, so only calls made with the WithContext methods of the clients
+// and the context of a handler request are part of the trace of the invocation.
+func Install(sess *session.Session) {
+	if sess == nil {
+		return
+	}
+
+	sess.Handlers.Send.PushFrontNamed(request.NamedHandler{Name: startHandlerName, Fn: startSpan})
+	sess.Handlers.Complete.PushBackNamed(request.NamedHandler{Name: endHandlerName, Fn: endSpan})
+}
+
+func startSpan(req *request.Request) {
+	// the send handlers run again for each retry, which belong to the same span
+	if req.Context().Value(spanKey{}) != nil {
+		return
+	}
+
+	service := req.ClientInfo.ServiceID
+	var operation string
+	if req.Operation != nil {
+		operation = req.Operation.Name
+	}
+
+	ctx, span := otel.Tracer(tracerName).Start(req.Context(), service+"."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "aws-api"),
+			attribute.String("rpc.service", service),
+			attribute.String("rpc.method", operation),
+		),
+	)
+	req.SetContext(context.WithValue(ctx, spanKey{}, span))
+}
+
+func endSpan(req *request.Request) {
+	span, ok := req.Context().Value(spanKey{}).(trace.Span)
+	if !ok {
+		return
+	}
+
+	if req.Error != nil {
+		span.RecordError(req.Error)
+		span.SetStatus(codes.Error, req.Error.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,112 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/tracing/tracingtest"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	awsv1 "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type failingHTTPClient struct{}
+
+func (failingHTTPClient) Do(*http.Request) (*http.Response, error) {
+	return nil, errors.New("no network")
+}
+
+func (c failingHTTPClient) RoundTrip(r *http.Request) (*http.Response, error) {
+	return c.Do(r)
+}
+
+func TestAppendMiddlewares(t *testing.T) {
+	exp := tracingtest.NewMemoryExporter()
+	tr := New(exp)
+
+	cfg := aws.Config{
+		Region:     "us-east-1",
+		HTTPClient: failingHTTPClient{},
+		Retryer:    func() aws.Retryer { return aws.NopRetryer{} },
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "id", SecretAccessKey: "secret"}, nil
+		}),
+	}
+	AppendMiddlewares(&cfg.APIOptions)
+
+	ctx, span := tr.Start(context.Background(), "CloudFormation CREATE", "")
+	if _, err := cloudwatch.NewFromConfig(cfg).ListDashboards(ctx, &cloudwatch.ListDashboardsInput{}); err == nil {
+		t.Fatalf("Expected the call to fail")
+	}
+	span.End()
+
+	if err := tr.Flush(context.Background()); err != nil {
+		t.Fatalf("Error returned: %v", err)
+	}
+
+	spans := exp.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+
+	call := spans[0]
+	if call.Name != "CloudWatch.ListDashboards" || call.SpanKind != trace.SpanKindClient {
+		t.Errorf("Unexpected span: %s %v", call.Name, call.SpanKind)
+	}
+	if call.Parent.SpanID() != spans[1].SpanContext.SpanID() {
+		t.Errorf("The API call should be a child of the invocation")
+	}
+	if call.Status.Code != codes.Error {
+		t.Errorf("Status = %v; want an error", call.Status)
+	}
+}
+
+func TestInstall(t *testing.T) {
+	// a CA bundle needs an *http.Transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	exp := tracingtest.NewMemoryExporter()
+	tr := New(exp)
+
+	sess := session.Must(session.NewSession(&awsv1.Config{
+		Region:      awsv1.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  awsv1.Int(2),
+		HTTPClient:  &http.Client{Transport: failingHTTPClient{}},
+	}))
+	Install(sess)
+
+	// sessions copied from the caller's, such as assumed roles, are traced too
+	ctx, span := tr.Start(context.Background(), "CloudFormation CREATE", "")
+	svc := cloudformation.New(sess.Copy())
+	if _, err := svc.ListStacksWithContext(ctx, &cloudformation.ListStacksInput{}); err == nil {
+		t.Fatalf("Expected the call to fail")
+	}
+	span.End()
+
+	if err := tr.Flush(context.Background()); err != nil {
+		t.Fatalf("Error returned: %v", err)
+	}
+
+	// the retries of a call are part of its span
+	spans := exp.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	call := spans[0]
+	if call.Name != "CloudFormation.ListStacks" || call.SpanKind != trace.SpanKindClient {
+		t.Errorf("Unexpected span: %s %v", call.Name, call.SpanKind)
+	}
+	if call.Parent.SpanID() != spans[1].SpanContext.SpanID() {
+		t.Errorf("The API call should be a child of the invocation")
+	}
+	if call.Status.Code != codes.Error {
+		t.Errorf("Status = %v; want an error", call.Status)
+	}
+}
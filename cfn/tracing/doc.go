@@ -0,0 +1,4 @@
+/*
+Package tracing traces resource provider invocations with OpenTelemetry.
+*/
+package tracing
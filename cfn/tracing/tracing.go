@@ -0,0 +1,140 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ExporterEnv is the environment variable selecting the span exporter,
+	// "stdout" or "otlp". Tracing is off when it isn't set.
+	//
+	// The OTLP exporter is configured with the standard OTEL_EXPORTER_OTLP_*
+	// environment variables, such as OTEL_EXPORTER_OTLP_ENDPOINT.
+	ExporterEnv = "CFN_TRACING_EXPORTER"
+
+	// ExporterStdout writes spans to stdout as JSON.
+	ExporterStdout = "stdout"
+
+	// ExporterOTLP sends spans to an OTLP/HTTP endpoint.
+	ExporterOTLP = "otlp"
+)
+
+// tracerName is the instrumentation scope of the runtime's spans.
+const tracerName = "github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn"
+
+// propagator carries span contexts between invocations.
+var propagator = propagation.TraceContext{}
+
+// ExporterFromEnv creates the exporter selected by CFN_TRACING_EXPORTER, or
+// returns nil when tracing is off.
+func ExporterFromEnv(ctx context.Context) (sdktrace.SpanExporter, error) {
+	switch v := strings.ToLower(os.Getenv(ExporterEnv)); v {
+	case "":
+		return nil, nil
+	case ExporterStdout:
+		return NewStdoutExporter(os.Stdout)
+	case ExporterOTLP:
+		return NewOTLPExporter(ctx, "")
+	default:
+		return nil, fmt.Errorf("unknown span exporter %q", v)
+	}
+}
+
+// NewStdoutExporter creates an exporter writing spans to w as JSON, for local runs.
+func NewStdoutExporter(w io.Writer) (sdktrace.SpanExporter, error) {
+	return stdouttrace.New(stdouttrace.WithWriter(w))
+}
+
+// NewOTLPExporter creates an exporter sending spans to an OTLP/HTTP endpoint
+// such as http://localhost:4318, or to the one configured in the environment
+// when endpoint is empty.
+func NewOTLPExporter(ctx context.Context, endpoint string) (sdktrace.SpanExporter, error) {
+	var opts []otlptracehttp.Option
+	if len(endpoint) != 0 {
+		opts = append(opts, otlptracehttp.WithEndpointURL(endpoint))
+	}
+
+	return otlptracehttp.New(ctx, opts...)
+}
+
+// A Tracer starts the spans of the invocations of a resource provider.
+//
+// A nil Tracer starts spans that aren't recorded.
+type Tracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+// New creates a Tracer exporting spans with exp.
+//
+// The Tracer is also installed as the global OpenTelemetry tracer provider,
+// so handlers and libraries using otel.Tracer create spans in the same traces.
+func New(exp sdktrace.SpanExporter) *Tracer {
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+
+	return &Tracer{
+		provider: provider,
+		tracer:   provider.Tracer(tracerName),
+	}
+}
+
+// Start starts the span of an invocation.
+//
+// traceParent is the W3C traceparent of the previous invocation of the operation,
+// if any, so that all the invocations of an operation belong to the same trace.
+func (t *Tracer) Start(ctx context.Context, name string, traceParent string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if t == nil {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+
+	var opts []trace.SpanStartOption
+	if previous := Extract(traceParent); previous.IsValid() {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, previous)
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: previous}))
+	}
+	opts = append(opts, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+
+	return t.tracer.Start(ctx, name, opts...)
+}
+
+// Flush exports the ended spans, giving up when ctx is done.
+func (t *Tracer) Flush(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+
+	return t.provider.ForceFlush(ctx)
+}
+
+// Inject returns the W3C traceparent of the span in ctx, or an empty string.
+func Inject(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+
+	return carrier.Get("traceparent")
+}
+
+// Extract parses a W3C traceparent.
+func Extract(traceParent string) trace.SpanContext {
+	if len(traceParent) == 0 {
+		return trace.SpanContext{}
+	}
+
+	ctx := propagator.Extract(context.Background(), propagation.MapCarrier{"traceparent": traceParent})
+
+	return trace.SpanContextFromContext(ctx)
+}
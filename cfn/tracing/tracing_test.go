@@ -0,0 +1,104 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/tracing/tracingtest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestExporterFromEnv(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantNil bool
+		wantErr bool
+	}{
+		{"", true, false},
+		{"stdout", false, false},
+		{"OTLP", false, false},
+		{"zipkin", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv(ExporterEnv, tt.value)
+
+			exp, err := ExporterFromEnv(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ExporterFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (exp == nil) != tt.wantNil {
+				t.Errorf("ExporterFromEnv() = %v, wantNil %v", exp, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestTracer(t *testing.T) {
+	exp := tracingtest.NewMemoryExporter()
+	tr := New(exp)
+
+	ctx, first := tr.Start(context.Background(), "CloudFormation CREATE", "", attribute.String("cfn.action", "CREATE"))
+	first.End()
+	traceParent := Inject(ctx)
+	if len(traceParent) == 0 {
+		t.Fatalf("No traceparent for the span")
+	}
+
+	// the next invocation of the operation
+	_, second := tr.Start(context.Background(), "CloudFormation CREATE", traceParent)
+	second.End()
+
+	if err := tr.Flush(context.Background()); err != nil {
+		t.Fatalf("Error returned: %v", err)
+	}
+
+	spans := exp.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	if spans[0].SpanKind != trace.SpanKindServer || spans[0].Attributes[0] != attribute.String("cfn.action", "CREATE") {
+		t.Errorf("Unexpected span: %+v", spans[0])
+	}
+	if spans[1].SpanContext.TraceID() != spans[0].SpanContext.TraceID() {
+		t.Errorf("Invocations of an operation should share a trace")
+	}
+	if spans[1].Parent.SpanID() != spans[0].SpanContext.SpanID() {
+		t.Errorf("Parent = %v; want the previous invocation", spans[1].Parent.SpanID())
+	}
+	if len(spans[1].Links) != 1 || spans[1].Links[0].SpanContext.SpanID() != spans[0].SpanContext.SpanID() {
+		t.Errorf("Links = %+v; want the previous invocation", spans[1].Links)
+	}
+}
+
+func TestTracer_Nil(t *testing.T) {
+	var tr *Tracer
+
+	ctx, span := tr.Start(context.Background(), "CloudFormation CREATE", "")
+	span.End()
+	if span.IsRecording() || len(Inject(ctx)) != 0 {
+		t.Errorf("A nil Tracer shouldn't record spans")
+	}
+	if err := tr.Flush(context.Background()); err != nil {
+		t.Errorf("Error returned: %v", err)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		traceParent string
+		wantValid   bool
+	}{
+		{"", false},
+		{"invalid", false},
+		{"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.traceParent, func(t *testing.T) {
+			if got := Extract(tt.traceParent); got.IsValid() != tt.wantValid {
+				t.Errorf("Extract(%q).IsValid() = %v; want %v", tt.traceParent, got.IsValid(), tt.wantValid)
+			}
+		})
+	}
+}
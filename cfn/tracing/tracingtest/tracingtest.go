@@ -0,0 +1,14 @@
+/*
+Package tracingtest provides utilities for testing the tracing of resource providers.
+*/
+package tracingtest
+
+import (
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// NewMemoryExporter creates an exporter keeping spans in memory, so tests
+// can assert on them.
+func NewMemoryExporter() *tracetest.InMemoryExporter {
+	return tracetest.NewInMemoryExporter()
+}
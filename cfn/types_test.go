@@ -1,10 +1,11 @@
 package cfn
 
 import (
+	"context"
+
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
 	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/cloudwatch"
-	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
 )
 
 // EmptyHandler is a implementation of Handler
@@ -63,7 +64,6 @@ func (m *MockHandler) List(request handler.Request) handler.ProgressEvent {
 //
 // This implementation of the handlers is only used for testing.
 type MockedMetrics struct {
-	cloudwatchiface.CloudWatchAPI
 	ResourceTypeName               string
 	HandlerExceptionCount          int
 	HandlerInvocationDurationCount int
@@ -80,7 +80,7 @@ func NewMockedMetrics() *MockedMetrics {
 // PutMetricData mocks the PutMetricData method.
 //
 // This implementation of the handlers is only used for testing.
-func (m *MockedMetrics) PutMetricData(in *cloudwatch.PutMetricDataInput) (*cloudwatch.PutMetricDataOutput, error) {
+func (m *MockedMetrics) PutMetricData(ctx context.Context, in *cloudwatch.PutMetricDataInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricDataOutput, error) {
 	m.ResourceTypeName = *in.Namespace
 	d := in.MetricData[0].MetricName
 	switch *d {
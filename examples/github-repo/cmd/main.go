@@ -2,6 +2,7 @@
 package main
 
 import (
+	_ "embed"
 	"errors"
 	"fmt"
 	"log"
@@ -11,6 +12,12 @@ import (
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/examples/github-repo/cmd/resource"
 )
 
+// schema is the resource schema, used to redact logged models and check
+// the handler permissions
+//
+//go:embed schema.json
+var schema []byte
+
 // Handler is a container for the CRUDL actions exported by resources
 type Handler struct{}
 
@@ -41,7 +48,7 @@ func (r *Handler) List(req handler.Request) handler.ProgressEvent {
 
 // main is the entry point of the application.
 func main() {
-	cfn.Start(&Handler{})
+	cfn.Start(&Handler{}, cfn.WithSchema(schema))
 }
 
 type handlerFunc func(handler.Request, *resource.Model, *resource.Model) (handler.ProgressEvent, error)
@@ -1,5 +1,6 @@
 # pylint: disable=useless-super-delegation,too-many-locals
 # pylint doesn't recognize abstract methods
+import json
 import logging
 import zipfile
 from pathlib import Path
@@ -130,7 +131,7 @@ class GoLanguagePlugin(LanguagePlugin):
             type_name=project.type_name,
             schema_path=project.schema_path,
             executable=EXECUTABLE,
-            files="model.go and main.go",
+            files="model.go, main.go and schema.json",
         )
         project.safewrite(path, contents)
 
@@ -194,6 +195,12 @@ class GoLanguagePlugin(LanguagePlugin):
         project.overwrite(path, contents)
         format_paths.append(path)
 
+        # The schema is embedded in the binary, for the runtime to redact
+        # models and check handler permissions
+        path = root / "schema.json"
+        LOG.debug("Writing schema: %s", path)
+        project.overwrite(path, json.dumps(project.schema, indent=4))
+
         path = root / "main.go"
         LOG.debug("Writing project: %s", path)
         template = self.env.get_template("main.go.tple")
@@ -145,6 +145,7 @@ def test_generate_resource(resource_project):
     assert files == {
         "makebuild",
         "cmd/main.go",
+        "cmd/schema.json",
         "cmd/resource/config.go",
         "cmd/resource/model.go",
     }